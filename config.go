@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/hlidotbe/macropad/discovery"
+	"github.com/hlidotbe/macropad/pad"
+	"github.com/hlidotbe/macropad/transport"
+)
+
+type actionConfig struct {
+	Type          string   `json:"type"`
+	ID            int      `json:"id"`              // For Track actions
+	Label         string   `json:"label"`           // For Track actions
+	Profile       string   `json:"profile"`         // For Track actions
+	DisplayOutput bool     `json:"display_output"`  // For Macro actions
+	Args          []string `json:"args"`            // For Type and Macro actions
+	Keys          string   `json:"keys,omitempty"`  // For Type actions
+	Duration      int      `json:"duration"`        // For Pomodoro actions
+	Layer         string   `json:"layer,omitempty"` // For Layer actions
+	Mode          string   `json:"mode,omitempty"`  // For Layer actions
+	// Policy while the action runs: parallel, queue, drop or restart. Track
+	// actions drop and Toggle actions queue by default, the others run in
+	// parallel.
+	Policy string `json:"policy,omitempty"`
+	// Timeout of the action in milliseconds, none when zero
+	Timeout int `json:"timeout,omitempty"`
+	// Steps of Sequence and Parallel actions, the steps of a sequence wait
+	// for their Delay in milliseconds
+	Steps           []*actionConfig `json:"steps,omitempty"`
+	ContinueOnError bool            `json:"continue_on_error,omitempty"`
+	Delay           int             `json:"delay,omitempty"`
+	// If checks a condition then runs the Then action, or the Else one
+	If   *conditionConfig `json:"if,omitempty"`
+	Then *actionConfig    `json:"then,omitempty"`
+	Else *actionConfig    `json:"else,omitempty"`
+	// Request of HTTP actions, the body and the URL being templates. The
+	// response must have Status, any 2xx when zero, and makes a notification
+	// when Notify, also a template, is set.
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Notify  string            `json:"notify,omitempty"`
+	// On and Off actions of Toggle actions, the Probe telling the actual
+	// state at startup
+	On    *actionConfig    `json:"on,omitempty"`
+	Off   *actionConfig    `json:"off,omitempty"`
+	Probe *conditionConfig `json:"probe,omitempty"`
+	// Script of Script actions, relative to ~/.macropad
+	Script string `json:"script,omitempty"`
+	// Options are the fields of the action types which have none above
+	Options map[string]interface{} `json:"options,omitempty"`
+	// Gestures are the actions bound to the other gestures of the key, by
+	// gesture name (double_tap, long_press, hold, release, and turn, cw and
+	// ccw for encoders)
+	Gestures     map[string]*actionConfig `json:"gestures,omitempty"`
+	Thresholds   *thresholdsConfig        `json:"thresholds,omitempty"`
+	Repeat       *repeatConfig            `json:"repeat,omitempty"`
+	Acceleration *accelerationConfig      `json:"acceleration,omitempty"`
+}
+
+// bound returns true if the key does something
+func (ac *actionConfig) bound() bool {
+	return len(ac.Type) > 0 || len(ac.Gestures) > 0
+}
+
+// params returns the fields of the action as the action types expect them
+func (ac *actionConfig) params() pad.Params {
+	p := make(pad.Params)
+	for k, v := range ac.Options {
+		p[k] = v
+	}
+	bytes, _ := json.Marshal(ac)
+	var fields map[string]interface{}
+	json.Unmarshal(bytes, &fields)
+	for k, v := range fields {
+		if _, ok := p[k]; !ok {
+			p[k] = v
+		}
+	}
+	return p
+}
+
+// check returns an error if the action of the key or of one of its gestures
+// cannot be created
+func (ac *actionConfig) check() error {
+	if len(ac.Type) > 0 {
+		if err := pad.CheckAction(ac.Type, ac.params()); err != nil {
+			return err
+		}
+	}
+	for name, gc := range ac.Gestures {
+		if err := gc.check(); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// profileConfig binds keys while the focused window matches Class and Title,
+// both regular expressions
+type profileConfig struct {
+	Name  string                   `json:"name"`
+	Class string                   `json:"class,omitempty"`
+	Title string                   `json:"title,omitempty"`
+	Keys  map[string]*actionConfig `json:"keys,omitempty"`
+}
+
+// profile returns the profile with the given name, nil if there is none
+func (c *padConfig) profile(name string) *profileConfig {
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			if p.Keys == nil {
+				p.Keys = make(map[string]*actionConfig)
+			}
+			return p
+		}
+	}
+	return nil
+}
+
+// leaderConfig designates the key starting leader sequences, bound as the
+// keys of the sequence separated by spaces
+type leaderConfig struct {
+	Key string `json:"key"`
+	// Timeout to type the next key of a sequence, in milliseconds
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// conditionConfig holds when Command exits with 0, when URL answers with Status
+// (any 2xx when zero) or while the LED of the binding named State is on
+type conditionConfig struct {
+	Command []string `json:"command,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Status  int      `json:"status,omitempty"`
+	State   string   `json:"state,omitempty"`
+}
+
+// repeatConfig runs an action again while its key is held, in milliseconds
+type repeatConfig struct {
+	Delay    int `json:"delay,omitempty"`
+	Interval int `json:"interval"`
+	Max      int `json:"max,omitempty"`
+}
+
+func (r *repeatConfig) repeat() pad.Repeat {
+	if r == nil {
+		return pad.Repeat{}
+	}
+	return pad.Repeat{
+		Delay:    time.Duration(r.Delay) * time.Millisecond,
+		Interval: time.Duration(r.Interval) * time.Millisecond,
+		Max:      r.Max,
+	}
+}
+
+// thresholdsConfig of the gesture detection of a key, in milliseconds
+type thresholdsConfig struct {
+	LongPress int `json:"long_press,omitempty"`
+	DoubleTap int `json:"double_tap,omitempty"`
+}
+
+func (t *thresholdsConfig) thresholds() pad.Thresholds {
+	if t == nil {
+		return pad.Thresholds{}
+	}
+	return pad.Thresholds{
+		LongPress: time.Duration(t.LongPress) * time.Millisecond,
+		DoubleTap: time.Duration(t.DoubleTap) * time.Millisecond,
+	}
+}
+
+// accelerationConfig of an encoder: steps within Window milliseconds of the
+// previous one count up to Max times
+type accelerationConfig struct {
+	Window int `json:"window"`
+	Max    int `json:"max"`
+}
+
+func (a *accelerationConfig) acceleration() pad.Acceleration {
+	if a == nil {
+		return pad.Acceleration{}
+	}
+	return pad.Acceleration{Window: time.Duration(a.Window) * time.Millisecond, Max: a.Max}
+}
+
+// linkConfig describes how to reach a pad
+type linkConfig struct {
+	Serial *discovery.Config `json:"serial,omitempty"`
+	// Protocol is either auto (handshake, falling back to legacy) or legacy
+	Protocol  string            `json:"protocol,omitempty"`
+	Transport *transport.Config `json:"transport,omitempty"`
+}
+
+// deviceConfig is the section of one of several pads
+type deviceConfig struct {
+	linkConfig
+	// Keys bound on this pad only, they take precedence over the shared ones
+	Keys   map[string]*actionConfig `json:"keys,omitempty"`
+	Layers layersConfig             `json:"layers,omitempty"`
+}
+
+// layersConfig are the keys bound on each layer above the base one
+type layersConfig map[string]map[string]*actionConfig
+
+// layer returns the keys bound on a layer, creating it if create is true
+func (d *deviceConfig) layer(name string, create bool) map[string]*actionConfig {
+	if len(name) == 0 || name == pad.BaseLayer {
+		return d.Keys
+	}
+	if d.Layers[name] == nil && create {
+		d.Layers[name] = make(map[string]*actionConfig)
+	}
+	return d.Layers[name]
+}
+
+// legacyKey returns the K<layer><index> name older configurations bind the
+// keys of the upper layers of a pad with, if any
+func legacyKey(layer string, key string) string {
+	if len(layer) != 1 || layer[0] < '1' || layer[0] > '9' || len(key) != 2 || key[0] != 'K' {
+		return ""
+	}
+	return "K" + layer + key[1:]
+}
+
+// padSections are the lowercase sections of ~/.macropad.yml
+type padSections struct {
+	linkConfig
+	Devices map[string]*deviceConfig `json:"devices,omitempty"`
+	// Layers are shared by every pad like the top level keys
+	Layers layersConfig  `json:"layers,omitempty"`
+	Leader *leaderConfig `json:"leader,omitempty"`
+	// Profiles are tried in order against the focused window
+	Profiles []*profileConfig `json:"profiles,omitempty"`
+	// ChordWindow is how long the keys of a chord have to be pressed
+	// together, in milliseconds
+	ChordWindow int `json:"chord_window,omitempty"`
+	// Injector sends the keystrokes of Type actions: cliclick, xdotool,
+	// ydotool, wtype or uinput, the one of the session when empty
+	Injector string `json:"injector,omitempty"`
+}
+
+// padConfig is the content of ~/.macropad.yml. Key bindings live at the top
+// level next to the lowercase sections, they are shared by every pad.
+type padConfig struct {
+	padSections
+	Keys map[string]*actionConfig
+}
+
+func isKey(name string) bool {
+	return len(name) > 0 && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+func (c *padConfig) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &c.padSections); err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	c.Keys = make(map[string]*actionConfig)
+	for name, v := range raw {
+		if !isKey(name) {
+			continue
+		}
+		ac := new(actionConfig)
+		if err := json.Unmarshal(v, ac); err != nil {
+			return err
+		}
+		c.Keys[name] = ac
+	}
+	return nil
+}
+
+func (c *padConfig) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(c.padSections)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	for k, ac := range c.Keys {
+		raw[k] = ac
+	}
+	return json.Marshal(raw)
+}
+
+// device returns the configuration of a pad, nil for unknown devices
+func (c *padConfig) device(id string) *deviceConfig {
+	if id == pad.DefaultDevice || len(id) == 0 {
+		if c.Layers == nil {
+			c.Layers = make(layersConfig)
+		}
+		return &deviceConfig{linkConfig: c.linkConfig, Keys: c.Keys, Layers: c.Layers}
+	}
+	d := c.Devices[id]
+	if d == nil {
+		return nil
+	}
+	// Devices inherit the top level link settings they do not override
+	merged := *d
+	if merged.Serial == nil {
+		merged.Serial = c.Serial
+	}
+	if len(merged.Protocol) == 0 {
+		merged.Protocol = c.Protocol
+	}
+	if merged.Transport == nil {
+		merged.Transport = c.Transport
+	}
+	if merged.Keys == nil {
+		d.Keys = make(map[string]*actionConfig)
+		merged.Keys = d.Keys
+	}
+	if merged.Layers == nil {
+		d.Layers = make(layersConfig)
+		merged.Layers = d.Layers
+	}
+	return &merged
+}
+
+// defaultPadPath is the HTTP path of websocket transports without an address
+const defaultPadPath = "/pad"
+
+// checkTransports returns an error when several pads would listen on the same
+// address, since devices inherit the top level transport they do not override
+func (c *padConfig) checkTransports() error {
+	listeners := make(map[string]string)
+	for _, id := range c.deviceIDs() {
+		t := c.device(id).Transport
+		if t == nil {
+			continue
+		}
+		address := t.Address
+		switch t.Type {
+		case "tcp-server":
+		case "websocket":
+			if len(address) == 0 {
+				address = defaultPadPath
+			}
+		default:
+			continue
+		}
+		key := t.Type + " " + address
+		if other, ok := listeners[key]; ok {
+			return fmt.Errorf("pads %s and %s both listen on %s %s, give each its own address", other, id, t.Type, address)
+		}
+		listeners[key] = id
+	}
+	return nil
+}
+
+// deviceIDs returns the ids of the configured pads
+func (c *padConfig) deviceIDs() []string {
+	if len(c.Devices) == 0 {
+		return []string{pad.DefaultDevice}
+	}
+	var ids []string
+	for id := range c.Devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func configPath() string {
+	u, err := user.Current()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return path.Join(u.HomeDir, ".macropad.yml")
+}
+
+// dataDir is the directory of the scripts and of the state of the actions,
+// next to the configuration
+func dataDir() string {
+	u, err := user.Current()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return path.Join(u.HomeDir, ".macropad")
+}
+
+func loadConfig() *padConfig {
+	file, err := os.Open(configPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	s, _ := file.Stat()
+	cfg := &padConfig{Keys: make(map[string]*actionConfig)}
+	if s.Size() > 0 {
+		buf := make([]byte, s.Size())
+		if _, err = file.Read(buf); err != nil {
+			log.Fatal(err)
+		}
+		err = yaml.Unmarshal(buf, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err = cfg.checkTransports(); err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
+
+func saveConfig() {
+	file, err := os.OpenFile(configPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	bytes, err := yaml.Marshal(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	file.Write(bytes)
+}
@@ -0,0 +1,202 @@
+// Package discovery finds the serial port a macropad is attached to
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	serial "go.bug.st/serial.v1"
+	"go.bug.st/serial.v1/enumerator"
+)
+
+// DefaultMatchers are used when the configuration does not provide any
+var DefaultMatchers = []Matcher{
+	{Name: "/dev/tty.usbmodem*"},
+	{Name: "/dev/cu.usbmodem*"},
+	{Name: "/dev/ttyACM*"},
+}
+
+var lister func() ([]*enumerator.PortDetails, error)
+
+func init() {
+	lister = enumerator.GetDetailedPortsList
+}
+
+// Config describes how to find and open the serial port
+type Config struct {
+	// Port bypasses discovery when set
+	Port     string    `json:"port,omitempty"`
+	Matchers []Matcher `json:"matchers,omitempty"`
+	Mode     Mode      `json:"mode"`
+}
+
+// Matcher selects ports from their name and USB metadata, empty fields match anything
+type Matcher struct {
+	// Name is a glob pattern on the port name (e.g. /dev/ttyACM*)
+	Name         string `json:"name,omitempty"`
+	VID          string `json:"vid,omitempty"`
+	PID          string `json:"pid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+}
+
+// Match returns true if the port satisfies every field of the matcher
+func (m Matcher) Match(p *enumerator.PortDetails) bool {
+	if len(m.Name) > 0 {
+		if ok, err := path.Match(m.Name, p.Name); err != nil || !ok {
+			return false
+		}
+	}
+	if len(m.VID) > 0 && !strings.EqualFold(m.VID, p.VID) {
+		return false
+	}
+	if len(m.PID) > 0 && !strings.EqualFold(m.PID, p.PID) {
+		return false
+	}
+	if len(m.SerialNumber) > 0 && m.SerialNumber != p.SerialNumber {
+		return false
+	}
+	return true
+}
+
+func (m Matcher) String() string {
+	var parts []string
+	if len(m.Name) > 0 {
+		parts = append(parts, "name="+m.Name)
+	}
+	if len(m.VID) > 0 {
+		parts = append(parts, "vid="+m.VID)
+	}
+	if len(m.PID) > 0 {
+		parts = append(parts, "pid="+m.PID)
+	}
+	if len(m.SerialNumber) > 0 {
+		parts = append(parts, "serial="+m.SerialNumber)
+	}
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, ",")
+}
+
+// Mode is the configurable counterpart of serial.Mode
+type Mode struct {
+	BaudRate int `json:"baud_rate,omitempty"`
+	DataBits int `json:"data_bits,omitempty"`
+	// Parity is one of none, odd, even, mark or space
+	Parity string `json:"parity,omitempty"`
+	// StopBits is one of 1, 1.5 or 2
+	StopBits string `json:"stop_bits,omitempty"`
+}
+
+// Serial converts the mode, applying 9600 8N1 defaults for missing fields
+func (m Mode) Serial() (*serial.Mode, error) {
+	mode := &serial.Mode{BaudRate: 9600, DataBits: 8, Parity: serial.NoParity, StopBits: serial.OneStopBit}
+	if m.BaudRate > 0 {
+		mode.BaudRate = m.BaudRate
+	}
+	if m.DataBits > 0 {
+		mode.DataBits = m.DataBits
+	}
+	switch strings.ToLower(m.Parity) {
+	case "", "none":
+	case "odd":
+		mode.Parity = serial.OddParity
+	case "even":
+		mode.Parity = serial.EvenParity
+	case "mark":
+		mode.Parity = serial.MarkParity
+	case "space":
+		mode.Parity = serial.SpaceParity
+	default:
+		return nil, fmt.Errorf("invalid parity %q", m.Parity)
+	}
+	switch m.StopBits {
+	case "", "1":
+	case "1.5":
+		mode.StopBits = serial.OnePointFiveStopBits
+	case "2":
+		mode.StopBits = serial.TwoStopBits
+	default:
+		return nil, fmt.Errorf("invalid stop bits %q", m.StopBits)
+	}
+	return mode, nil
+}
+
+// NoMatchError is returned when no port satisfies the matchers
+type NoMatchError struct {
+	Matchers   []Matcher
+	Candidates []*enumerator.PortDetails
+}
+
+func (e *NoMatchError) Error() string {
+	if len(e.Candidates) == 0 {
+		return "No serial ports found!"
+	}
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "No serial port matches %v, candidates are:", e.Matchers)
+	for _, p := range e.Candidates {
+		b.WriteString("\n\t" + Describe(p))
+	}
+	return b.String()
+}
+
+// Describe formats a port and its USB metadata on a single line
+func Describe(p *enumerator.PortDetails) string {
+	if !p.IsUSB {
+		return p.Name
+	}
+	return fmt.Sprintf("%s (vid=%s pid=%s serial=%s)", p.Name, p.VID, p.PID, p.SerialNumber)
+}
+
+// List enumerates the serial ports with their USB metadata
+func List() ([]*enumerator.PortDetails, error) {
+	return lister()
+}
+
+// Find returns the first port matching one of the matchers, in matcher order.
+// Ports named in skip, e.g. because they are already in use, are ignored.
+func Find(matchers []Matcher, skip ...string) (*enumerator.PortDetails, error) {
+	if len(matchers) == 0 {
+		matchers = DefaultMatchers
+	}
+	ports, err := lister()
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	for _, m := range matchers {
+		for _, p := range ports {
+			if !skipped[p.Name] && m.Match(p) {
+				return p, nil
+			}
+		}
+	}
+	return nil, &NoMatchError{Matchers: matchers, Candidates: ports}
+}
+
+// Open finds the configured port and opens it with the configured mode, see
+// Find for skip
+func Open(c *Config, skip ...string) (serial.Port, string, error) {
+	mode, err := c.Mode.Serial()
+	if err != nil {
+		return nil, "", err
+	}
+	name := c.Port
+	if len(name) == 0 {
+		p, err := Find(c.Matchers, skip...)
+		if err != nil {
+			return nil, "", err
+		}
+		name = p.Name
+	}
+	port, err := serial.Open(name, mode)
+	if err != nil {
+		return nil, name, err
+	}
+	return port, name, nil
+}
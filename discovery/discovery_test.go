@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"strings"
+	"testing"
+
+	serial "go.bug.st/serial.v1"
+	"go.bug.st/serial.v1/enumerator"
+)
+
+var testPorts = []*enumerator.PortDetails{
+	{Name: "/dev/ttyS0"},
+	{Name: "/dev/ttyACM0", IsUSB: true, VID: "2341", PID: "8036", SerialNumber: "A"},
+	{Name: "/dev/ttyACM1", IsUSB: true, VID: "239A", PID: "800B", SerialNumber: "B"},
+}
+
+func withPorts(ports []*enumerator.PortDetails) func() {
+	oldLister := lister
+	lister = func() ([]*enumerator.PortDetails, error) { return ports, nil }
+	return func() { lister = oldLister }
+}
+
+func TestFind(t *testing.T) {
+	defer withPorts(testPorts)()
+
+	p, err := Find(nil)
+	if err != nil || p.Name != "/dev/ttyACM0" {
+		t.Errorf("Expected default matchers to find /dev/ttyACM0, got %v (%v)", p, err)
+	}
+	p, err = Find(nil, "/dev/ttyACM0")
+	if err != nil || p.Name != "/dev/ttyACM1" {
+		t.Errorf("Expected /dev/ttyACM0 to be skipped, got %v (%v)", p, err)
+	}
+	p, err = Find([]Matcher{{VID: "239a", PID: "800b"}})
+	if err != nil || p.Name != "/dev/ttyACM1" {
+		t.Errorf("Expected VID/PID to find /dev/ttyACM1, got %v (%v)", p, err)
+	}
+	p, err = Find([]Matcher{{Name: "/dev/ttyACM*", SerialNumber: "B"}})
+	if err != nil || p.Name != "/dev/ttyACM1" {
+		t.Errorf("Expected serial number to find /dev/ttyACM1, got %v (%v)", p, err)
+	}
+}
+
+func TestFind_NoMatch(t *testing.T) {
+	defer withPorts(testPorts)()
+
+	_, err := Find([]Matcher{{VID: "dead"}})
+	nm, ok := err.(*NoMatchError)
+	if !ok {
+		t.Fatalf("Expected a NoMatchError, got %v", err)
+	}
+	if len(nm.Candidates) != 3 {
+		t.Errorf("Expected 3 candidates, got %d", len(nm.Candidates))
+	}
+	if !strings.Contains(err.Error(), "/dev/ttyACM1 (vid=239A pid=800B serial=B)") {
+		t.Errorf("Expected candidates in the error, got %q", err.Error())
+	}
+
+	defer withPorts(nil)()
+	_, err = Find(nil)
+	if err == nil || err.Error() != "No serial ports found!" {
+		t.Errorf("Expected no ports error, got %v", err)
+	}
+}
+
+func TestModeSerial(t *testing.T) {
+	m, err := Mode{}.Serial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.BaudRate != 9600 || m.DataBits != 8 || m.Parity != serial.NoParity || m.StopBits != serial.OneStopBit {
+		t.Errorf("Expected 9600 8N1 defaults, got %+v", m)
+	}
+	m, err = Mode{BaudRate: 115200, DataBits: 7, Parity: "even", StopBits: "2"}.Serial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.BaudRate != 115200 || m.DataBits != 7 || m.Parity != serial.EvenParity || m.StopBits != serial.TwoStopBits {
+		t.Errorf("Mode not converted, got %+v", m)
+	}
+	if _, err = (Mode{Parity: "sometimes"}).Serial(); err == nil {
+		t.Error("Expected an invalid parity error")
+	}
+}
@@ -0,0 +1,107 @@
+// Package focus tells which window has the focus, so that the pad can bind
+// keys per application.
+package focus
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Window is the focused window
+type Window struct {
+	// Class is the application part of the window class, e.g. firefox
+	Class string
+	Title string
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%s (%s)", w.Class, w.Title)
+}
+
+// Provider returns the focused window
+type Provider interface {
+	Focused() (Window, error)
+}
+
+// command runs a program and returns its output, replaced in tests
+var command = func(name string, arg ...string) ([]byte, error) {
+	return exec.Command(name, arg...).Output()
+}
+
+// XDoTool asks X11 for the focused window through xdotool
+type XDoTool struct{}
+
+// Focused returns the class and the title of the active window
+func (XDoTool) Focused() (Window, error) {
+	class, err := command("xdotool", "getactivewindow", "getwindowclassname")
+	if err != nil {
+		return Window{}, fmt.Errorf("xdotool: %v", err)
+	}
+	title, err := command("xdotool", "getactivewindow", "getwindowname")
+	if err != nil {
+		return Window{}, fmt.Errorf("xdotool: %v", err)
+	}
+	return Window{Class: strings.TrimSpace(string(class)), Title: strings.TrimSpace(string(title))}, nil
+}
+
+// Fake is a provider whose focused window is set by tests
+type Fake struct {
+	mu     sync.Mutex
+	window Window
+	err    error
+}
+
+// Set the focused window
+func (f *Fake) Set(w Window) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.window = w
+	f.err = nil
+}
+
+// Fail makes Focused return err
+func (f *Fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Focused returns the window last set
+func (f *Fake) Focused() (Window, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.window, f.err
+}
+
+// Watch polls p every interval and calls changed with the focused window
+// when it changes, until stop is closed. Errors are logged when they change.
+func Watch(p Provider, interval time.Duration, changed func(Window), stop <-chan bool) {
+	var last Window
+	var lastErr string
+	first := true
+	for {
+		w, err := p.Focused()
+		if err != nil {
+			if err.Error() != lastErr {
+				log.Printf("Cannot tell the focused window (%v)\n", err)
+				lastErr = err.Error()
+			}
+		} else {
+			lastErr = ""
+			if first || w != last {
+				first = false
+				last = w
+				changed(w)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
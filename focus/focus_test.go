@@ -0,0 +1,60 @@
+package focus
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestXDoTool(t *testing.T) {
+	defer func(c func(string, ...string) ([]byte, error)) { command = c }(command)
+	command = func(name string, arg ...string) ([]byte, error) {
+		if arg[1] == "getwindowclassname" {
+			return []byte("jetbrains-goland\n"), nil
+		}
+		return []byte("macropad – main.go\n"), nil
+	}
+	w, err := XDoTool{}.Focused()
+	if err != nil || w.Class != "jetbrains-goland" || w.Title != "macropad – main.go" {
+		t.Errorf("Unexpected window %v (%v)", w, err)
+	}
+
+	command = func(name string, arg ...string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	}
+	if _, err = (XDoTool{}).Focused(); err == nil {
+		t.Error("Expected the failure of xdotool to be reported")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	f := new(Fake)
+	f.Set(Window{Class: "firefox", Title: "Inbox"})
+	changes := make(chan Window, 10)
+	stop := make(chan bool)
+	defer close(stop)
+	go Watch(f, time.Millisecond, func(w Window) {
+		changes <- w
+	}, stop)
+
+	expect := func(class string) {
+		select {
+		case w := <-changes:
+			if w.Class != class {
+				t.Errorf("Expected %s, got %v", class, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s to be focused", class)
+		}
+	}
+	expect("firefox")
+	f.Fail(errors.New("no display"))
+	time.Sleep(10 * time.Millisecond)
+	f.Set(Window{Class: "kitty", Title: "~"})
+	expect("kitty")
+	select {
+	case w := <-changes:
+		t.Errorf("Unexpected change to %v", w)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
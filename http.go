@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	rice "github.com/GeertJohan/go.rice"
+	"github.com/hlidotbe/macropad/pad"
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+func setupHTTP() {
+	http.HandleFunc("/keys", handleKeys)
+	http.HandleFunc("/status", handleStatus)
+	http.HandleFunc("/capabilities", handleCapabilities)
+	http.HandleFunc("/actions", handleActions)
+	http.Handle("/", http.FileServer(rice.MustFindBox("templates").HTTPBox()))
+	log.Fatal(http.ListenAndServe(":6276", nil))
+}
+
+// requestDevice returns the device addressed by the device query parameter,
+// the default one when missing
+func requestDevice(request *http.Request) (string, *deviceConfig) {
+	id := request.URL.Query().Get("device")
+	if len(id) == 0 {
+		id = pad.DefaultDevice
+	}
+	return id, config.device(id)
+}
+
+// handleKeys reads and writes the binding of key k on the layer given by the
+// layer query parameter, the base one when missing
+func handleKeys(response http.ResponseWriter, request *http.Request) {
+	k := request.URL.Query().Get("k")
+	layer := request.URL.Query().Get("layer")
+	id, d := requestDevice(request)
+	if d == nil || len(k) == 0 || strings.ContainsAny(layer, ".:/+") {
+		response.WriteHeader(404)
+		return
+	}
+	var keys map[string]*actionConfig
+	legacy := legacyKey(layer, k)
+	// Profiles are layers shared by every pad
+	if p := config.profile(layer); p != nil && len(layer) > 0 {
+		if id != pad.DefaultDevice {
+			response.WriteHeader(404)
+			return
+		}
+		keys = p.Keys
+	} else {
+		keys = d.layer(layer, request.Method != "GET")
+	}
+	if request.Method == "GET" {
+		ac := keys[k]
+		if ac == nil && len(legacy) > 0 {
+			ac = d.Keys[legacy]
+		}
+		if ac == nil {
+			response.WriteHeader(404)
+			return
+		}
+		bytes, _ := json.Marshal(ac)
+		response.Write(bytes)
+	} else {
+		defer request.Body.Close()
+		decoder := json.NewDecoder(request.Body)
+		update := new(actionConfig)
+		err := decoder.Decode(update)
+		if err != nil {
+			log.Println(err)
+			response.WriteHeader(500)
+			return
+		}
+		if err = update.check(); err != nil {
+			response.WriteHeader(400)
+			response.Write([]byte(err.Error()))
+			return
+		}
+		name := pad.DeviceKey(id, pad.LayerKey(layer, k))
+		ac := keys[k]
+		if ac != nil {
+			log.Printf("Unregistering %v\n", name)
+			unregisterKey(name, ac)
+		}
+		// Older configurations bind upper layers as K<layer><index>, the key
+		// moves to its layer
+		if old := d.Keys[legacy]; len(legacy) > 0 && old != nil {
+			unregisterKey(pad.DeviceKey(id, legacy), old)
+			delete(d.Keys, legacy)
+		}
+		ac = update
+		keys[k] = ac
+		log.Printf("Setting up %v\n", ac)
+		if ac.bound() {
+			setupKey(name, ac)
+		}
+		saveConfig()
+	}
+}
+
+// handleActions lists the action types and their fields
+func handleActions(response http.ResponseWriter, request *http.Request) {
+	bytes, _ := json.Marshal(pad.ActionKinds())
+	response.Write(bytes)
+}
+
+type deviceStatus struct {
+	ID         string `json:"id"`
+	Connection string `json:"connection"`
+}
+
+type status struct {
+	Connection string         `json:"connection"`
+	Devices    []deviceStatus `json:"devices"`
+	Profile    string         `json:"profile"`
+	// Executions of the bindings which are running, queued or dropped
+	Executions map[string]pad.ExecutionStats `json:"executions"`
+}
+
+func handleStatus(response http.ResponseWriter, request *http.Request) {
+	s := status{Connection: orch.ConnectionState().String(), Profile: orch.Profile(), Executions: orch.Executions()}
+	for _, id := range config.deviceIDs() {
+		s.Devices = append(s.Devices, deviceStatus{ID: id, Connection: orch.DeviceState(id).String()})
+	}
+	bytes, _ := json.Marshal(s)
+	response.Write(bytes)
+}
+
+type capabilities struct {
+	protocol.Capabilities
+	Warnings []string `json:"warnings"`
+	// Chords and Sequences bound on the layer given by the layer query
+	// parameter
+	Chords     []string `json:"chords"`
+	Sequences  []string `json:"sequences"`
+	LayerNames []string `json:"layer_names"`
+}
+
+func handleCapabilities(response http.ResponseWriter, request *http.Request) {
+	id, d := requestDevice(request)
+	if d == nil {
+		response.WriteHeader(404)
+		return
+	}
+	layer := request.URL.Query().Get("layer")
+	if len(layer) == 0 {
+		layer = pad.BaseLayer
+	}
+	// The pad's own bindings hide the shared ones
+	sources := []*deviceConfig{d}
+	if id != pad.DefaultDevice {
+		sources = append(sources, config.device(pad.DefaultDevice))
+	}
+	bound := make(map[string]bool)
+	layers := make(map[string]bool)
+	collect := func(l string, keys map[string]*actionConfig) {
+		for k, ac := range keys {
+			name := pad.LayerKey(l, k)
+			if _, own := bound[name]; !own {
+				bound[name] = ac.bound()
+			}
+		}
+	}
+	for _, s := range sources {
+		collect(pad.BaseLayer, s.Keys)
+		for l, keys := range s.Layers {
+			layers[l] = true
+			collect(l, keys)
+		}
+	}
+	var keys, chords, sequences, layerNames []string
+	for name, b := range bound {
+		if !b {
+			continue
+		}
+		if l, k := pad.SplitLayerKey(name); l == layer && pad.IsSequence(k) {
+			sequences = append(sequences, k)
+		} else if l == layer && pad.IsChord(k) {
+			chords = append(chords, k)
+		}
+		keys = append(keys, pad.PhysicalKeys(name)...)
+	}
+	for _, p := range config.Profiles {
+		layers[p.Name] = true
+		for k, ac := range p.Keys {
+			if ac.bound() {
+				keys = append(keys, pad.PhysicalKeys(k)...)
+			}
+		}
+	}
+	for l := range layers {
+		layerNames = append(layerNames, l)
+	}
+	sort.Strings(chords)
+	sort.Strings(sequences)
+	sort.Strings(layerNames)
+	caps := orch.DeviceCapabilities(id)
+	bytes, _ := json.Marshal(capabilities{Capabilities: caps, Warnings: pad.CheckKeys(caps, keys), Chords: chords, Sequences: sequences, LayerNames: layerNames})
+	response.Write(bytes)
+}
@@ -1,23 +1,28 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/user"
 	"path"
-	"strings"
+	"sync"
 	"time"
 
 	serial "go.bug.st/serial.v1"
 
-	rice "github.com/GeertJohan/go.rice"
-	"github.com/ghodss/yaml"
 	"github.com/hlidotbe/macropad/auxilium"
+	"github.com/hlidotbe/macropad/discovery"
+	"github.com/hlidotbe/macropad/focus"
 	"github.com/hlidotbe/macropad/pad"
+	"github.com/hlidotbe/macropad/protocol"
+	"github.com/hlidotbe/macropad/record"
+	"github.com/hlidotbe/macropad/transport"
+	"github.com/hlidotbe/macropad/virtual"
 )
 
 type rw struct {
@@ -35,172 +40,396 @@ func (s *rw) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
-type actionConfig struct {
-	Type          string   `json:"type"`
-	ID            int      `json:"id"`             // For Track actions
-	Label         string   `json:"label"`          // For Track actions
-	Profile       string   `json:"profile"`        // For Track actions
-	DisplayOutput bool     `json:"display_output"` // For Macro actions
-	Args          []string `json:"args"`           // For Type and Macro actions
-	Duration      int      `json:"duration"`       // For Pomodoro actions
+func (s *rw) Close() error {
+	return nil
 }
 
 var auxiliumClient *auxilium.Client
-var config *map[string]*actionConfig
+var injector pad.Injector
+var store *pad.Store
+var config *padConfig
 var orch *pad.Orchestrator
 
+var recorder *record.Recorder
+var watchingFocus bool
+
+var portFlag = flag.String("port", "", "serial port of the default pad, bypassing discovery")
+var recordFlag = flag.String("record", "", "record the traffic with the pads to the given file")
+var speedFlag = flag.Float64("speed", 1, "replay speed factor, 0 to replay as fast as possible")
+var dryRunFlag = flag.Bool("dry-run", false, "log the actions instead of executing them")
+
 func main() {
+	flag.Parse()
 	config = loadConfig()
 
-	go setupHTTP()
-
-	port := openPort()
+	if flag.Arg(0) == "bridge" {
+		bridge(flag.Arg(1))
+		return
+	}
 
 	auxiliumClient = auxilium.NewClient(nil, os.Getenv("AUXILIUM_TOKEN"), "https://track.epic.net/api")
+	var err error
+	if injector, err = pad.NewInjector(config.Injector); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Typing with %s\n", injector)
+	if store, err = pad.OpenStore(path.Join(dataDir(), "store.json")); err != nil {
+		log.Fatal(err)
+	}
 
-	orch = pad.NewOchestrator(port)
+	orch = pad.NewOchestrator(nil)
+	orch.SetChordWindow(time.Duration(config.ChordWindow) * time.Millisecond)
+	if config.Leader != nil {
+		orch.SetLeader(config.Leader.Key, time.Duration(config.Leader.Timeout)*time.Millisecond)
+	}
 	setupKeys()
 
+	if flag.Arg(0) == "replay" {
+		replay(flag.Arg(1))
+		return
+	}
+
+	if len(*recordFlag) > 0 {
+		f, err := os.Create(*recordFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		recorder = record.NewRecorder(f)
+	}
+
+	var supervisors []*pad.Supervisor
+	if flag.Arg(0) == "virtual" {
+		s := pad.NewSupervisor(orch, recorded(pad.DefaultDevice, virtualPad()))
+		s.Codec = openCodec(config.Protocol)
+		supervisors = append(supervisors, s)
+	} else {
+		for _, id := range config.deviceIDs() {
+			d := config.device(id)
+			if id == pad.DefaultDevice && len(*portFlag) > 0 {
+				d.Serial = &discovery.Config{Port: *portFlag}
+				if config.Serial != nil {
+					d.Serial.Mode = config.Serial.Mode
+				}
+			}
+			s := pad.NewSupervisor(orch, recorded(id, opener(d.linkConfig)))
+			s.Codec = openCodec(d.Protocol)
+			s.Device = id
+			supervisors = append(supervisors, s)
+		}
+	}
+	go setupHTTP()
+
+	for _, s := range supervisors {
+		go s.Run()
+	}
+
 	orch.Run()
 }
 
-func setupHTTP() {
-	http.HandleFunc("/keys", handleKeys)
-	http.Handle("/", http.FileServer(rice.MustFindBox("templates").HTTPBox()))
-	log.Fatal(http.ListenAndServe(":6276", nil))
+// portsInUse are the serial ports opened by a device, skipped by discovery
+var portsInUse = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// serialPort releases its name on Close
+type serialPort struct {
+	serial.Port
+	name string
 }
 
-func loadConfig() *map[string]*actionConfig {
-	u, err := user.Current()
-	if err != nil {
-		log.Fatal(err)
+func (p *serialPort) Close() error {
+	portsInUse.Lock()
+	delete(portsInUse.names, p.name)
+	portsInUse.Unlock()
+	return p.Port.Close()
+}
+
+//*
+func openPort(sc *discovery.Config) pad.Opener {
+	if sc == nil {
+		sc = new(discovery.Config)
 	}
-	configFile := path.Join(u.HomeDir, ".macropad.yml")
-	file, err := os.Open(configFile)
-	if err != nil {
-		log.Fatal(err)
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		portsInUse.Lock()
+		defer portsInUse.Unlock()
+		var skip []string
+		for name := range portsInUse.names {
+			skip = append(skip, name)
+		}
+		port, name, err := discovery.Open(sc, skip...)
+		if err != nil {
+			return nil, err
+		}
+		portsInUse.names[name] = true
+		fmt.Printf("Found port: %v\n", name)
+		return &serialPort{Port: port, name: name}, nil
 	}
-	defer file.Close()
-	s, _ := file.Stat()
-	cfg := make(map[string]*actionConfig)
-	if s.Size() > 0 {
-		buf := make([]byte, s.Size())
-		if _, err = file.Read(buf); err != nil {
+}
+
+//*/
+/*
+func openPort(sc *discovery.Config) pad.Opener {
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return &rw{in: os.Stdin, out: os.Stdout}, nil
+	}
+}
+
+//*/
+
+// opener returns how to reach a pad according to its transport configuration
+func opener(lc linkConfig) pad.Opener {
+	sc := lc.Serial
+	t := lc.Transport
+	if t == nil {
+		return openPort(sc)
+	}
+	switch t.Type {
+	case "", "serial":
+		return openPort(sc)
+	case "tcp-server":
+		server, err := transport.Listen(t.Address, t.Token)
+		if err != nil {
 			log.Fatal(err)
 		}
-		err = yaml.Unmarshal(buf, &cfg)
+		log.Printf("Waiting for pads on %v\n", server.Addr())
+		return server.Accept
+	case "tcp-client":
+		return func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return transport.Dial(t.Address, t.Token)
+		}
+	case "websocket":
+		ws, err := transport.NewWebSocket(t.Token, t.Origins...)
 		if err != nil {
 			log.Fatal(err)
 		}
+		address := t.Address
+		if len(address) == 0 {
+			address = defaultPadPath
+		}
+		http.Handle(address, ws)
+		return ws.Accept
 	}
-	return &cfg
+	log.Fatalf("Unknown transport %s", t.Type)
+	return nil
 }
 
-func saveConfig() {
-	u, err := user.Current()
+// virtualPad creates a pad on a pseudo-terminal, whose path is printed so that
+// K00-style lines can be sent from another terminal
+func virtualPad() pad.Opener {
+	vp, err := virtual.New()
 	if err != nil {
 		log.Fatal(err)
 	}
-	configFile := path.Join(u.HomeDir, ".macropad.yml")
-	file, err := os.OpenFile(configFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	fmt.Printf("Virtual pad: %s\n", vp.Path())
+	opened := false
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		if opened {
+			return nil, errors.New("virtual pad closed")
+		}
+		opened = true
+		return vp.Host(), nil
+	}
+}
+
+// recorded wraps the ports opened by open with the recorder, if any
+func recorded(device string, open pad.Opener) pad.Opener {
+	if recorder == nil {
+		return open
+	}
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		port, err := open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return recorder.Wrap(device, port), nil
+	}
+}
+
+// replay feeds a recording to the orchestrator, printing the replayed traffic
+func replay(path string) {
+	if len(path) == 0 {
+		log.Fatal("Usage: macropad [-speed factor] [-dry-run] replay <recording>")
+	}
+	f, err := os.Open(path)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer file.Close()
-	bytes, err := yaml.Marshal(config)
+	entries, err := record.Parse(f)
+	f.Close()
 	if err != nil {
 		log.Fatal(err)
 	}
-	file.Write(bytes)
+	go orch.Run()
+	if err = record.Replay(entries, orch, *speedFlag, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	orch.Shutdown()
 }
 
-//*
-func openPort() serial.Port {
-	ports, err := serial.GetPortsList()
-	if err != nil {
-		log.Fatal(err)
+// bridge relays the local pad to a daemon listening with a tcp-server transport
+func bridge(address string) {
+	if len(address) == 0 {
+		log.Fatal("Usage: macropad bridge <host:port>")
 	}
-	if len(ports) == 0 {
-		log.Fatal("No serial ports found!")
+	var token string
+	if config.Transport != nil {
+		token = config.Transport.Token
 	}
-	var portName string
-	for _, p := range ports {
-		if strings.HasPrefix(p, "/dev/tty.usbmodem") {
-			portName = p
-			break
+	open := opener(linkConfig{Serial: config.Serial})
+	for {
+		port, err := open(context.Background())
+		if err != nil {
+			log.Println(err)
+			time.Sleep(time.Second)
+			continue
+		}
+		remote, err := transport.Dial(address, token)
+		if err != nil {
+			log.Println(err)
+			port.Close()
+			time.Sleep(time.Second)
+			continue
 		}
+		log.Printf("Bridging to %s\n", address)
+		log.Println(transport.Pipe(port, remote))
+		remote.Close()
+		port.Close()
+		time.Sleep(time.Second)
 	}
-	fmt.Printf("Found port: %v\n", portName)
-	mode := &serial.Mode{}
-	port, err := serial.Open(portName, mode)
-	if err != nil {
-		log.Fatal(err)
+}
+
+func openCodec(version string) func(io.ReadWriter) (protocol.Codec, error) {
+	return func(port io.ReadWriter) (protocol.Codec, error) {
+		if version == "legacy" {
+			return protocol.NewLegacyCodec(port), nil
+		}
+		return protocol.Negotiate(port, 500*time.Millisecond)
 	}
-	return port
 }
 
-//*/
-/*
-func openPort() io.ReadWriter {
-	return &rw{in: os.Stdin, out: os.Stdout}
+func setupKeys() {
+	setupLayers(pad.DefaultDevice, config.Keys, config.Layers)
+	for id, d := range config.Devices {
+		setupLayers(id, d.Keys, d.Layers)
+	}
+	setupProfiles()
 }
 
-//*/
+// setupProfiles registers the keys of the profiles on their layer and
+// follows the focused window when there are profiles
+func setupProfiles() {
+	var profiles []pad.Profile
+	for _, pc := range config.Profiles {
+		p, err := pad.NewProfile(pc.Name, pc.Class, pc.Title)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		profiles = append(profiles, p)
+		for key, ac := range pc.Keys {
+			setupKey(pad.LayerKey(p.Name, key), ac)
+			log.Printf("%v: %v\n", pad.LayerKey(p.Name, key), ac)
+		}
+	}
+	orch.SetProfiles(profiles)
+	if len(profiles) > 0 && !watchingFocus {
+		watchingFocus = true
+		go focus.Watch(focus.XDoTool{}, 500*time.Millisecond, orch.Focus, nil)
+	}
+}
 
-func setupKeys() {
-	for key, ac := range *config {
-		setupKey(key, ac)
-		log.Printf("%v: %v\n", key, ac)
+// setupLayers registers the keys of a device on every layer
+func setupLayers(id string, keys map[string]*actionConfig, layers layersConfig) {
+	for key, ac := range keys {
+		setupKey(pad.DeviceKey(id, key), ac)
+		log.Printf("%v: %v\n", pad.DeviceKey(id, key), ac)
+	}
+	for layer, keys := range layers {
+		for key, ac := range keys {
+			name := pad.DeviceKey(id, pad.LayerKey(layer, key))
+			setupKey(name, ac)
+			log.Printf("%v: %v\n", name, ac)
+		}
 	}
 }
 
+// setupKey registers the actions of key, which may be qualified with a device,
+// and of its gestures
 func setupKey(key string, ac *actionConfig) {
-	switch ac.Type {
-	case "Track":
-		orch.RegisterAction(key, pad.NewActionTrack(key, orch.Com, auxiliumClient, ac.Label, ac.ID, ac.Profile))
-		break
-	case "Type":
-		orch.RegisterAction(key, pad.NewActionType(key, orch.Com, ac.Args...))
-		break
-	case "Macro":
-		orch.RegisterAction(key, pad.NewActionMacro(key, orch.Com, ac.DisplayOutput, ac.Args...))
-		break
-	case "Pomodoro":
-		orch.RegisterAction(key, pad.NewActionPomodoro(key, orch.Com, time.Duration(ac.Duration)*time.Minute))
-		break
-	}
-}
-
-func handleKeys(response http.ResponseWriter, request *http.Request) {
-	k := request.URL.Query()["k"][0]
-	if request.Method == "GET" {
-		ac := (*config)[k]
-		if ac == nil {
-			response.WriteHeader(404)
-			return
+	setupAction(key, ac)
+	for name, gc := range ac.Gestures {
+		if !isGesture(name) {
+			log.Printf("Unknown gesture %s on %s\n", name, key)
+			continue
 		}
-		bytes, _ := json.Marshal(ac)
-		response.Write(bytes)
-	} else {
-		defer request.Body.Close()
-		ac := (*config)[k]
-		if ac != nil {
-			log.Printf("Unregistering %v\n", k)
-			orch.UnregisterAction(k)
-		}
-		decoder := json.NewDecoder(request.Body)
-		ac = new(actionConfig)
-		err := decoder.Decode(ac)
+		setupAction(pad.GestureKey(key, pad.Gesture(name)), gc)
+	}
+	orch.SetThresholds(key, ac.Thresholds.thresholds())
+	orch.SetAcceleration(key, ac.Acceleration.acceleration())
+}
+
+// unregisterKey is the reverse of setupKey
+func unregisterKey(key string, ac *actionConfig) {
+	orch.UnregisterAction(key)
+	orch.SetRepeat(key, pad.Repeat{})
+	orch.SetPolicy(key, pad.Parallel)
+	orch.SetTimeout(key, 0)
+	for name := range ac.Gestures {
+		orch.UnregisterAction(pad.GestureKey(key, pad.Gesture(name)))
+		orch.SetRepeat(pad.GestureKey(key, pad.Gesture(name)), pad.Repeat{})
+		orch.SetPolicy(pad.GestureKey(key, pad.Gesture(name)), pad.Parallel)
+		orch.SetTimeout(pad.GestureKey(key, pad.Gesture(name)), 0)
+	}
+	orch.SetThresholds(key, pad.Thresholds{})
+	orch.SetAcceleration(key, pad.Acceleration{})
+}
+
+func isGesture(name string) bool {
+	for _, g := range pad.Gestures {
+		if string(g) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setupAction registers the action described by ac under name
+func setupAction(key string, ac *actionConfig) {
+	orch.SetRepeat(key, ac.Repeat.repeat())
+	orch.SetTimeout(key, time.Duration(ac.Timeout)*time.Millisecond)
+	policy := pad.Policy(ac.Policy)
+	if len(ac.Type) > 0 {
+		kind, err := pad.LookupActionKind(ac.Type)
 		if err != nil {
-			log.Println(err)
-			response.WriteHeader(500)
+			log.Printf("%s: %v\n", key, err)
 			return
 		}
-		(*config)[k] = ac
-		log.Printf("Setting up %v\n", ac)
-		if len(ac.Type) > 0 {
-			setupKey(k, ac)
+		if len(policy) == 0 {
+			policy = kind.Policy
 		}
-		saveConfig()
 	}
+	if err := orch.SetPolicy(key, policy); err != nil {
+		log.Printf("%s: %v\n", key, err)
+	}
+	if len(ac.Type) == 0 {
+		return
+	}
+	env := pad.Env{Out: orch.Com, Layers: orch.Layers(), Auxilium: auxiliumClient, State: orch.State, Injector: injector,
+		Run: orch.RunAction, Store: store, Scripts: dataDir()}
+	a, err := pad.CreateAction(ac.Type, key, env, ac.params())
+	if err != nil {
+		log.Printf("%s: %v\n", key, err)
+		return
+	}
+	register(key, a)
+}
+
+// register the action for key, only logging it when running dry
+func register(key string, a pad.Action) {
+	if *dryRunFlag {
+		a = pad.DryRun(key, a)
+	}
+	orch.RegisterAction(key, a)
 }
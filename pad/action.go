@@ -1,10 +1,14 @@
 package pad
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hlidotbe/macropad/auxilium"
@@ -24,12 +28,80 @@ var builder actionCommandBuilder
 
 func init() {
 	builder = &realBuilder{}
+	RegisterActionKind(ActionKind{
+		Name:  ActionTrack,
+		Label: "Track",
+		Fields: []Field{
+			{Name: "id", Kind: FieldInt, Label: "Project", Required: true},
+			{Name: "label", Kind: FieldString, Label: "Label"},
+			{Name: "profile", Kind: FieldString, Label: "Profile"},
+		},
+		// Mashing the key would create duplicate time tracks
+		Policy: Drop,
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionTrack(name, env.Out, env.Auxilium, p.String("label"), p.Int("id"), p.String("profile")), nil
+		},
+	})
+	RegisterActionKind(ActionKind{
+		Name:  ActionType,
+		Label: "Type",
+		Fields: []Field{
+			{Name: "args", Kind: FieldStrings, Label: "Arguments"},
+			{Name: "keys", Kind: FieldString, Label: "Keys"},
+		},
+		New: func(name string, env Env, p Params) (Action, error) {
+			a := NewActionType(name, env.Out, p.Strings("args")...).(*actionType)
+			if keys := p.String("keys"); len(keys) > 0 {
+				a.strokes, _ = ParseKeys(keys)
+			}
+			if env.Injector != nil {
+				a.injector = env.Injector
+			}
+			if err := a.injector.Check(a.strokes); err != nil {
+				return nil, err
+			}
+			return a, nil
+		},
+		Check: func(p Params) error {
+			args, keys := p.Strings("args"), p.String("keys")
+			switch {
+			case len(args) > 0 && len(keys) > 0:
+				return fmt.Errorf("expected either args or keys")
+			case len(keys) > 0:
+				if _, err := ParseKeys(keys); err != nil {
+					return fmt.Errorf("keys: %v", err)
+				}
+			case len(args) == 0:
+				return fmt.Errorf("args or keys is required")
+			}
+			return nil
+		},
+	})
+	RegisterActionKind(ActionKind{
+		Name:  ActionMacro,
+		Label: "Macro",
+		Fields: []Field{
+			{Name: "display_output", Kind: FieldBool, Label: "Display output?"},
+			{Name: "args", Kind: FieldStrings, Label: "Arguments", Required: true},
+		},
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionMacro(name, env.Out, p.Bool("display_output"), p.Strings("args")...), nil
+		},
+	})
+	RegisterActionKind(ActionKind{
+		Name:   ActionPomodoro,
+		Label:  "Pomodoro",
+		Fields: []Field{{Name: "duration", Kind: FieldDuration, Label: "Duration (minutes)", Required: true, Unit: time.Minute}},
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionPomodoro(name, env.Out, p.Duration("duration")), nil
+		},
+	})
 }
 
 const (
 	// ActionPomodoro action toggles a pomorodo timer of the given duration
 	ActionPomodoro string = "pomodoro"
-	// ActionType action send the configured string to the foremost active window
+	// ActionType action send keystrokes to the foremost active window
 	ActionType = "type"
 	// ActionTrack toggles time tracking on the given project
 	ActionTrack = "track"
@@ -45,29 +117,34 @@ type Action interface {
 
 // Concrete actions
 type actionType struct {
-	name string
-	out  chan<- ActionMessage
-	args []string
+	name     string
+	out      chan<- ActionMessage
+	args     []string
+	strokes  []Keystroke
+	injector Injector
 }
 
-// NewActionType configure and returns an action that passes args to cliclick
+// NewActionType configure and returns an action that sends the keystrokes
+// described by args, in the format of cliclick, with cliclick
 func NewActionType(name string, out chan<- ActionMessage, args ...string) Action {
 	a := new(actionType)
 	a.name = name
 	a.out = out
 	a.args = args
+	a.strokes = ParseCliclick(args)
+	a.injector = cliclick{}
 	return a
 }
 
 func (a *actionType) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *actionType) ExecuteContext(ctx context.Context) error {
 	a.out <- ActionMessage{ActionName: a.name, Notify: "", Progress: 127}
-	cmd := builder.Build("cliclick", a.args...)
-	out, err := cmd.CombinedOutput()
+	err := a.injector.Inject(ctx, a.strokes)
 	a.out <- ActionMessage{ActionName: a.name, Notify: "", Progress: 0}
-	if err != nil {
-		return fmt.Errorf("%s (%v)", string(out), err)
-	}
-	return nil
+	return err
 }
 
 func (a *actionType) Stop() {
@@ -79,6 +156,10 @@ type actionMacro struct {
 	out           chan<- ActionMessage
 	displayOutput bool
 	args          []string
+	// cancels of the running commands, killed by Stop
+	mu      sync.Mutex
+	cancels map[int]context.CancelFunc
+	next    int
 }
 
 // NewActionMacro configure and return an action executing given command, optionnaly notifying the user with its output
@@ -88,12 +169,36 @@ func NewActionMacro(name string, out chan<- ActionMessage, display bool, args ..
 	a.out = out
 	a.displayOutput = display
 	a.args = args
+	a.cancels = make(map[int]context.CancelFunc)
 	return a
 }
 
 func (a *actionMacro) Execute() error {
-	cmd := builder.Build(a.args[0], a.args[1:]...)
-	out, err := cmd.CombinedOutput()
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *actionMacro) ExecuteContext(ctx context.Context) error {
+	return a.exec(ctx, a.args)
+}
+
+func (a *actionMacro) exec(ctx context.Context, args []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.next++
+	id := a.next
+	a.cancels[id] = cancel
+	a.mu.Unlock()
+	defer func() {
+		cancel()
+		a.mu.Lock()
+		delete(a.cancels, id)
+		a.mu.Unlock()
+	}()
+	cmd := builder.Build(args[0], args[1:]...)
+	out, err := runCommand(ctx, cmd)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
 		return fmt.Errorf("%s (%v)", string(out), err)
 	}
@@ -103,8 +208,31 @@ func (a *actionMacro) Execute() error {
 	return nil
 }
 
+// Stop kills the running commands
 func (a *actionMacro) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, cancel := range a.cancels {
+		cancel()
+	}
+}
+
+// Turn runs the command with {delta} replaced by the steps of the encoder
+func (a *actionMacro) Turn(ctx context.Context, delta int) error {
+	return a.run(ctx, "{delta}", strconv.Itoa(delta))
+}
 
+// SetValue runs the command with {value} replaced by the analog value
+func (a *actionMacro) SetValue(ctx context.Context, value int) error {
+	return a.run(ctx, "{value}", strconv.Itoa(value))
+}
+
+func (a *actionMacro) run(ctx context.Context, placeholder string, value string) error {
+	args := make([]string, len(a.args))
+	for i, arg := range a.args {
+		args[i] = strings.Replace(arg, placeholder, value, -1)
+	}
+	return a.exec(ctx, args)
 }
 
 type actionPomodoro struct {
@@ -131,6 +259,22 @@ func IsAProgressAction(a Action) bool {
 		return ok
 	}
 	_, ok = a.(*actionType)
+	if ok {
+		return ok
+	}
+	_, ok = a.(*actionComposite)
+	if ok {
+		return ok
+	}
+	_, ok = a.(*actionIf)
+	if ok {
+		return ok
+	}
+	_, ok = a.(*actionScript)
+	if ok {
+		return ok
+	}
+	_, ok = a.(*actionToggle)
 	return ok
 }
 
@@ -1,6 +1,7 @@
 package pad
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -25,14 +26,20 @@ func TestExecute_Type(t *testing.T) {
 
 	builder = testActionCommandBuilder{}
 
-	com := make(chan ActionMessage, 1)
+	com := make(chan ActionMessage, 2)
 	a := NewAction(ActionType, "K1", com, "t:git", "kp:space", "t:epic", "kp:space", "t:live", "kp:enter")
 	err := a.Execute()
 	if err != nil {
 		t.Errorf("Should have passed, got: \"%v\" instead", err)
 	}
-	if len(com) != 0 {
-		t.Errorf("Did not expect a message from ActionType, got %v", <-com)
+	// ActionType only shows its progress while typing
+	if len(com) != 2 {
+		t.Errorf("Expected the progress of ActionType, got %d messages", len(com))
+	}
+	for len(com) > 0 {
+		if msg := <-com; len(msg.Notify) > 0 {
+			t.Errorf("Did not expect a notification from ActionType, got %v", msg)
+		}
 	}
 }
 
@@ -66,6 +73,39 @@ func TestExecute_Macro(t *testing.T) {
 	}
 }
 
+func TestExecute_MacroCancel(t *testing.T) {
+	oldBuilder := builder
+	defer func() { builder = oldBuilder }()
+
+	builder = testActionCommandBuilder{}
+
+	a := NewAction(ActionMacro, "K1", make(chan ActionMessage, 1), false, "sleep")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := Execute(ctx, a); err != context.DeadlineExceeded {
+		t.Errorf("Expected the macro to time out, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Error("Expected the command to be killed")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Execute()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	a.Stop()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected the macro to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected Stop to kill the command")
+	}
+}
+
 func TestExecute_Pomodoro(t *testing.T) {
 	out := make(chan ActionMessage, 100)
 	a := NewAction(ActionPomodoro, "K1", out, time.Millisecond)
@@ -74,7 +114,10 @@ func TestExecute_Pomodoro(t *testing.T) {
 		t.Errorf("Should have passed, got: '%v' instead", err)
 		return
 	}
-	time.Sleep(time.Millisecond * 10)
+	// Timers are not that precise, give the ticks some time to come
+	for deadline := time.Now().Add(time.Second); len(out) < 100 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
 	if len(out) != 100 {
 		t.Error("Pomodoro probably didn't start")
 	}
@@ -137,6 +180,13 @@ func TestHelperProcess(*testing.T) {
 	case "open":
 		os.Exit(0)
 		break
+	case "false":
+		os.Exit(1)
+		break
+	case "sleep":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+		break
 	case "echo":
 		fmt.Println(args)
 		os.Exit(0)
@@ -0,0 +1,215 @@
+package pad
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultChordWindow is how long the keys of a chord have to be pressed together
+const DefaultChordWindow = 50 * time.Millisecond
+
+// ChordKeys returns the keys of a chord name such as K0+K3, a single key for
+// other names
+func ChordKeys(name string) []string {
+	return strings.Split(name, "+")
+}
+
+// IsChord returns true if name binds several keys
+func IsChord(name string) bool {
+	return strings.Contains(name, "+")
+}
+
+// keyInput is a press or release of a key at a given time
+type keyInput struct {
+	key     string
+	pressed bool
+	at      time.Time
+}
+
+// chord bound on a device
+type chord struct {
+	name string
+	keys map[string]bool
+}
+
+// chordState is the detection state of one device
+type chordState struct {
+	gen int
+	// pending inputs while the window is open, down the keys pressed in it
+	pending []keyInput
+	down    map[string]bool
+	timer   *time.Timer
+	// consumed keys are part of a fired chord, their releases are swallowed
+	consumed map[string]string
+	active   map[string]bool
+}
+
+// chordDetector recognises chords among the presses of a device and passes
+// everything else to next unchanged. chords lists the chords bound on a
+// device.
+type chordDetector struct {
+	mu      sync.Mutex
+	window  time.Duration
+	devices map[string]*chordState
+	chords  func(device string) []chord
+	next    func(device, key string, pressed bool, at time.Time)
+}
+
+func newChordDetector(chords func(string) []chord, next func(string, string, bool, time.Time)) *chordDetector {
+	return &chordDetector{
+		window:  DefaultChordWindow,
+		devices: make(map[string]*chordState),
+		chords:  chords,
+		next:    next,
+	}
+}
+
+func (d *chordDetector) setWindow(w time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if w <= 0 {
+		w = DefaultChordWindow
+	}
+	d.window = w
+}
+
+func (d *chordDetector) state(device string) *chordState {
+	s := d.devices[device]
+	if s == nil {
+		s = &chordState{
+			down:     make(map[string]bool),
+			consumed: make(map[string]string),
+			active:   make(map[string]bool),
+		}
+		d.devices[device] = s
+	}
+	return s
+}
+
+// feed a press or a release of key on device
+func (d *chordDetector) feed(device, key string, pressed bool, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.state(device)
+	in := keyInput{key: key, pressed: pressed, at: at}
+	if !pressed {
+		d.release(device, s, in)
+		return
+	}
+	chords := d.chords(device)
+	if len(s.pending) == 0 {
+		if !inChord(chords, map[string]bool{key: true}) {
+			d.next(device, key, true, at)
+			return
+		}
+		s.gen++
+		gen := s.gen
+		s.pending = append(s.pending, in)
+		s.down[key] = true
+		s.timer = time.AfterFunc(d.window, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if s.gen == gen {
+				d.resolve(device, s, chords)
+			}
+		})
+		return
+	}
+	s.pending = append(s.pending, in)
+	s.down[key] = true
+	if !inChord(chords, s.down) || complete(chords, s.down) {
+		d.resolve(device, s, chords)
+	}
+}
+
+func (d *chordDetector) release(device string, s *chordState, in keyInput) {
+	if name, ok := s.consumed[in.key]; ok {
+		delete(s.consumed, in.key)
+		// The chord is released along with its first key
+		if s.active[name] {
+			delete(s.active, name)
+			d.next(device, name, false, in.at)
+		}
+		return
+	}
+	if s.down[in.key] {
+		s.pending = append(s.pending, in)
+		d.resolve(device, s, d.chords(device))
+		return
+	}
+	d.next(device, in.key, false, in.at)
+}
+
+// resolve closes the window, firing the chord of the pressed keys if any and
+// passing the pending inputs on otherwise
+func (d *chordDetector) resolve(device string, s *chordState, chords []chord) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.gen++
+	pending := s.pending
+	down := s.down
+	s.pending = nil
+	s.down = make(map[string]bool)
+	name := match(chords, down)
+	if len(down) < 2 || len(name) == 0 {
+		for _, in := range pending {
+			d.next(device, in.key, in.pressed, in.at)
+		}
+		return
+	}
+	for key := range down {
+		s.consumed[key] = name
+	}
+	s.active[name] = true
+	d.next(device, name, true, pending[0].at)
+	for _, in := range pending {
+		if !in.pressed {
+			d.release(device, s, in)
+		}
+	}
+}
+
+// inChord returns true if keys are part of a bound chord
+func inChord(chords []chord, keys map[string]bool) bool {
+	for _, c := range chords {
+		if contains(c.keys, keys) {
+			return true
+		}
+	}
+	return false
+}
+
+// complete returns true if keys are a chord that no other chord extends
+func complete(chords []chord, keys map[string]bool) bool {
+	if len(match(chords, keys)) == 0 {
+		return false
+	}
+	for _, c := range chords {
+		if len(c.keys) > len(keys) && contains(c.keys, keys) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the name of the chord made of exactly keys
+func match(chords []chord, keys map[string]bool) string {
+	for _, c := range chords {
+		if len(c.keys) == len(keys) && contains(c.keys, keys) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+func contains(set map[string]bool, keys map[string]bool) bool {
+	for k := range keys {
+		if !set[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package pad
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestChords(names ...string) (*chordDetector, chan string) {
+	inputs := make(chan string, 10)
+	var chords []chord
+	for _, name := range names {
+		c := chord{name: name, keys: make(map[string]bool)}
+		for _, k := range ChordKeys(name) {
+			c.keys[k] = true
+		}
+		chords = append(chords, c)
+	}
+	d := newChordDetector(func(device string) []chord {
+		return chords
+	}, func(device, key string, pressed bool, at time.Time) {
+		if pressed {
+			inputs <- key + " down"
+		} else {
+			inputs <- key + " up"
+		}
+	})
+	d.setWindow(30 * time.Millisecond)
+	return d, inputs
+}
+
+func expectInputs(t *testing.T, inputs chan string, expected ...string) {
+	t.Helper()
+	var got []string
+	timeout := time.After(200 * time.Millisecond)
+	for len(got) < len(expected) {
+		select {
+		case in := <-inputs:
+			got = append(got, in)
+		case <-timeout:
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	select {
+	case in := <-inputs:
+		t.Errorf("Unexpected %s", in)
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestChord(t *testing.T) {
+	d, inputs := newTestChords("K0+K3")
+	now := time.Now()
+	d.feed(DefaultDevice, "K3", true, now)
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	d.feed(DefaultDevice, "K3", false, now)
+	expectInputs(t, inputs, "K0+K3 down", "K0+K3 up")
+}
+
+func TestChordSingleKeys(t *testing.T) {
+	d, inputs := newTestChords("K0+K3")
+	now := time.Now()
+	d.feed(DefaultDevice, "K1", true, now)
+	expectInputs(t, inputs, "K1 down")
+
+	// Alone after the window
+	d.feed(DefaultDevice, "K0", true, now)
+	expectInputs(t, inputs, "K0 down")
+	d.feed(DefaultDevice, "K0", false, now)
+	expectInputs(t, inputs, "K0 up")
+
+	// Released before the other key of the chord
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	expectInputs(t, inputs, "K0 down", "K0 up")
+
+	// With a key outside of the chord
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K1", true, now)
+	expectInputs(t, inputs, "K0 down", "K1 down")
+}
+
+func TestLongestChord(t *testing.T) {
+	d, inputs := newTestChords("K0+K1", "K0+K1+K2")
+	now := time.Now()
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K1", true, now)
+	d.feed(DefaultDevice, "K2", true, now)
+	expectInputs(t, inputs, "K0+K1+K2 down")
+
+	d.feed(DefaultDevice, "K0", false, now)
+	d.feed(DefaultDevice, "K1", false, now)
+	d.feed(DefaultDevice, "K2", false, now)
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K1", true, now)
+	expectInputs(t, inputs, "K0+K1+K2 up", "K0+K1 down")
+}
@@ -0,0 +1,289 @@
+package pad
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ActionSequence runs its steps one after the other
+	ActionSequence = "sequence"
+	// ActionParallel runs its steps all at once
+	ActionParallel = "parallel"
+)
+
+// step of a composite action, run after delay in a sequence
+type step struct {
+	action Action
+	delay  time.Duration
+}
+
+func init() {
+	fields := []Field{
+		{Name: "steps", Kind: FieldActions, Label: "Steps", Required: true},
+		{Name: "continue_on_error", Kind: FieldBool, Label: "Continue on error?"},
+	}
+	RegisterActionKind(ActionKind{
+		Name:   ActionSequence,
+		Label:  "Sequence",
+		Fields: fields,
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionComposite(name, env, p.Actions("steps"), false, p.Bool("continue_on_error"))
+		},
+	})
+	RegisterActionKind(ActionKind{
+		Name:   ActionParallel,
+		Label:  "Parallel",
+		Fields: fields,
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionComposite(name, env, p.Actions("steps"), true, p.Bool("continue_on_error"))
+		},
+	})
+}
+
+// stepDelay is the field of the steps of a sequence giving their delay, in
+// milliseconds
+var stepDelay = Field{Name: "delay", Kind: FieldDuration, Unit: time.Millisecond}
+
+// NewActionComposite configure and returns an action running the actions
+// described by steps, one after the other or all at once when parallel is
+// true. A failing step ends a sequence and cancels the other steps of a
+// parallel group, unless continueOnError is true. The steps of a sequence
+// wait for the delay given in their fields, in milliseconds.
+func NewActionComposite(name string, env Env, steps []ActionConfig, parallel bool, continueOnError bool) (Action, error) {
+	a := newComposite(name, env.Out, parallel, continueOnError)
+	env.Out = a.in
+	for i, c := range steps {
+		var s step
+		if d, ok := c.Params[stepDelay.Name]; ok && d != nil {
+			delay, err := stepDelay.decode(d)
+			if err != nil {
+				a.Stop()
+				return nil, fmt.Errorf("step %d: delay: %v", i, err)
+			}
+			s.delay = delay.(time.Duration)
+		}
+		child, err := CreateAction(c.Type, fmt.Sprintf("%s#%d", name, i), env, c.Params)
+		if err != nil {
+			a.Stop()
+			return nil, fmt.Errorf("step %d: %v", i, err)
+		}
+		s.action = child
+		a.steps = append(a.steps, s)
+	}
+	return a, nil
+}
+
+// actionComposite runs several actions, relaying their messages as its own
+type actionComposite struct {
+	*relay
+	steps           []step
+	parallel        bool
+	continueOnError bool
+}
+
+func newComposite(name string, out chan<- ActionMessage, parallel bool, continueOnError bool) *actionComposite {
+	return &actionComposite{
+		relay:           newRelay(name, out),
+		parallel:        parallel,
+		continueOnError: continueOnError,
+	}
+}
+
+func (a *actionComposite) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *actionComposite) ExecuteContext(ctx context.Context) error {
+	defer a.setOwn(0)
+	if a.parallel {
+		return a.runParallel(ctx)
+	}
+	return a.runSequence(ctx)
+}
+
+func (a *actionComposite) runSequence(ctx context.Context) error {
+	var errs []string
+	for i, s := range a.steps {
+		a.setOwn(stepProgress(i, len(a.steps)))
+		if s.delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.delay):
+			}
+		}
+		err := Execute(ctx, s.action)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if !a.continueOnError {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+			errs = append(errs, fmt.Sprintf("step %d: %v", i, err))
+		}
+	}
+	return combine(errs, len(a.steps))
+}
+
+func (a *actionComposite) runParallel(ctx context.Context) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []string
+	finished := 0
+	a.setOwn(stepProgress(0, len(a.steps)))
+	for i, s := range a.steps {
+		wg.Add(1)
+		go func(i int, s step) {
+			defer wg.Done()
+			err := Execute(ctx, s.action)
+			mu.Lock()
+			defer mu.Unlock()
+			finished++
+			a.setOwn(stepProgress(finished, len(a.steps)))
+			if err == nil || (ctx.Err() != nil && err == ctx.Err()) {
+				return
+			}
+			errs = append(errs, fmt.Sprintf("step %d: %v", i, err))
+			if !a.continueOnError {
+				cancel()
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	if len(errs) == 0 && parent.Err() != nil {
+		return parent.Err()
+	}
+	return combine(errs, len(a.steps))
+}
+
+// stepProgress returns the progress of a composite having done done of total
+// steps, never 0 which turns the progress off
+func stepProgress(done int, total int) byte {
+	if total == 0 {
+		return 1
+	}
+	p := byte(done * 255 / total)
+	if p == 0 {
+		p = 1
+	}
+	return p
+}
+
+func combine(errs []string, total int) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d steps failed: %s", len(errs), total, strings.Join(errs, "; "))
+}
+
+func (a *actionComposite) Stop() {
+	for _, s := range a.steps {
+		s.action.Stop()
+	}
+	a.close()
+}
+
+// relay sends the messages of nested actions as the ones of the action named
+// name: the notifications as they come, the state on when any nested action is
+// on and the progress of the one the furthest along, or of the action itself
+// while it runs.
+type relay struct {
+	name string
+	out  chan<- ActionMessage
+	// in is the channel of the nested actions
+	in   chan ActionMessage
+	done chan bool
+	stop sync.Once
+
+	mu       sync.Mutex
+	states   map[string]int8
+	progress map[string]byte
+	own      byte
+}
+
+func newRelay(name string, out chan<- ActionMessage) *relay {
+	r := &relay{
+		name:     name,
+		out:      out,
+		in:       make(chan ActionMessage, 10),
+		done:     make(chan bool),
+		states:   make(map[string]int8),
+		progress: make(map[string]byte),
+	}
+	go r.forward()
+	return r
+}
+
+// close stops relaying once the nested actions are stopped
+func (a *relay) close() {
+	a.stop.Do(func() {
+		close(a.done)
+	})
+}
+
+func (a *relay) setOwn(p byte) {
+	a.mu.Lock()
+	a.own = p
+	msg := ActionMessage{ActionName: a.name, Progress: a.combinedProgress()}
+	a.mu.Unlock()
+	a.out <- msg
+}
+
+// forward the messages of the nested actions until close. The nested actions
+// stopping may still send a last message, they are drained for a while.
+func (a *relay) forward() {
+	for {
+		select {
+		case m := <-a.in:
+			a.out <- a.combine(m)
+		case <-a.done:
+			for {
+				select {
+				case <-a.in:
+				case <-time.After(time.Second):
+					return
+				}
+			}
+		}
+	}
+}
+
+// combine the message of a nested action with the state and progress of the
+// others
+func (a *relay) combine(m ActionMessage) ActionMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if m.State != 0 {
+		a.states[m.ActionName] = m.State
+	}
+	a.progress[m.ActionName] = m.Progress
+	msg := ActionMessage{ActionName: a.name, Notify: m.Notify, Progress: a.combinedProgress()}
+	if m.State != 0 {
+		msg.State = -1
+		for _, s := range a.states {
+			if s == 1 {
+				msg.State = 1
+			}
+		}
+	}
+	return msg
+}
+
+// combinedProgress must be called with the lock held
+func (a *relay) combinedProgress() byte {
+	p := a.own
+	for _, c := range a.progress {
+		if c > p {
+			p = c
+		}
+	}
+	return p
+}
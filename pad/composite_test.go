@@ -0,0 +1,156 @@
+package pad
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stepAction records the order in which the steps run in a shared log
+type stepAction struct {
+	name string
+	log  *stepLog
+	fail bool
+}
+
+type stepLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (a *stepAction) Execute() error {
+	a.log.mu.Lock()
+	a.log.names = append(a.log.names, a.name)
+	a.log.mu.Unlock()
+	if a.fail {
+		return errors.New(a.name + " failed")
+	}
+	return nil
+}
+
+func (a *stepAction) Stop() {
+}
+
+func (l *stepLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.names, ",")
+}
+
+// testSteps are the actions created by the "test" kind, by name
+var testSteps = map[string]Action{}
+
+func init() {
+	RegisterActionKind(ActionKind{
+		Name:   "test",
+		Fields: []Field{{Name: "name", Kind: FieldString, Required: true}},
+		New: func(name string, env Env, p Params) (Action, error) {
+			if p.String("name") == "led" {
+				return &ledAction{name: name, out: env.Out}, nil
+			}
+			return testSteps[p.String("name")], nil
+		},
+	})
+}
+
+func testStep(name string, extra ...interface{}) map[string]interface{} {
+	m := map[string]interface{}{"type": "test", "name": name}
+	for i := 0; i+1 < len(extra); i += 2 {
+		m[extra[i].(string)] = extra[i+1]
+	}
+	return m
+}
+
+func newTestComposite(t *testing.T, kind string, continueOnError bool, steps ...interface{}) (Action, chan ActionMessage) {
+	t.Helper()
+	out := make(chan ActionMessage, 100)
+	a, err := CreateAction(kind, "K0", Env{Out: out}, Params{"steps": steps, "continue_on_error": continueOnError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, out
+}
+
+func TestSequence(t *testing.T) {
+	log := &stepLog{}
+	testSteps["a"] = &stepAction{name: "a", log: log}
+	testSteps["b"] = &stepAction{name: "b", log: log, fail: true}
+	testSteps["c"] = &stepAction{name: "c", log: log}
+
+	a, _ := newTestComposite(t, ActionSequence, false, testStep("a"), testStep("b"), testStep("c"))
+	if err := a.Execute(); err == nil || !strings.Contains(err.Error(), "b failed") {
+		t.Errorf("Expected the sequence to fail on b, got %v", err)
+	}
+	if log.String() != "a,b" {
+		t.Errorf("Expected the sequence to stop after b, got %s", log)
+	}
+
+	log.names = nil
+	a, _ = newTestComposite(t, ActionSequence, true, testStep("a"), testStep("b"), testStep("c", "delay", float64(30)))
+	started := time.Now()
+	if err := a.Execute(); err == nil || !strings.HasPrefix(err.Error(), "1 of 3 steps failed") {
+		t.Errorf("Expected one failed step, got %v", err)
+	}
+	if log.String() != "a,b,c" {
+		t.Errorf("Expected every step to run, got %s", log)
+	}
+	if time.Since(started) < 30*time.Millisecond {
+		t.Error("Expected c to wait for its delay")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	log := &stepLog{}
+	blocking := &blockingAction{started: make(chan bool, 10)}
+	testSteps["blocking"] = blocking
+	testSteps["failing"] = &stepAction{name: "failing", log: log, fail: true}
+
+	a, _ := newTestComposite(t, ActionParallel, false, testStep("blocking"), testStep("failing"))
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Execute()
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "failing failed") {
+			t.Errorf("Expected the group to fail, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the failure to cancel the blocking step")
+	}
+
+	a, _ = newTestComposite(t, ActionParallel, true, testStep("blocking"), testStep("failing"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Execute(ctx, a); err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("Expected the group to wait for the blocking step, got %v", err)
+	}
+}
+
+func TestCompositeMessages(t *testing.T) {
+	nested := []interface{}{testStep("led")}
+	a, out := newTestComposite(t, ActionParallel, false, map[string]interface{}{"type": "Sequence", "steps": nested})
+	if err := a.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(time.Second)
+	for lit := false; !lit; {
+		select {
+		case msg := <-out:
+			if msg.ActionName != "K0" {
+				t.Fatalf("Expected the messages of the steps to come from K0, got %v", msg)
+			}
+			lit = msg.State == 1
+		case <-timeout:
+			t.Fatal("Expected the composite to be lit by its step")
+		}
+	}
+	a.Stop()
+
+	if _, err := CreateAction(ActionSequence, "K0", Env{}, Params{"steps": []interface{}{testStep("a"), map[string]interface{}{"type": "Unknown"}}}); err == nil {
+		t.Error("Expected an unknown step type to be rejected")
+	}
+}
@@ -0,0 +1,175 @@
+package pad
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// ActionIf runs one of two actions depending on a Condition
+const ActionIf = "if"
+
+func init() {
+	RegisterActionKind(ActionKind{
+		Name:  ActionIf,
+		Label: "If",
+		Fields: []Field{
+			{Name: "if", Kind: FieldCondition, Label: "If", Required: true},
+			{Name: "then", Kind: FieldAction, Label: "Then", Required: true},
+			{Name: "else", Kind: FieldAction, Label: "Else"},
+		},
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionIf(name, env, p.Condition("if"), p.Action("then"), p.Action("else"))
+		},
+	})
+}
+
+// Condition checked by an if action, set with one of Command, URL or State
+type Condition struct {
+	// Command holds when it exits with 0
+	Command []string
+	// URL holds when a GET answers with Status, any 2xx when zero
+	URL    string
+	Status int
+	// State is the name of a binding, holding while its LED is on
+	State string
+}
+
+// conditionClient queries the URLs of the conditions
+var conditionClient = &http.Client{Timeout: 5 * time.Second}
+
+// decodeCondition checks a condition, given as a Condition or as a map of its
+// fields in lower case
+func decodeCondition(v interface{}) (interface{}, error) {
+	c, ok := v.(Condition)
+	if !ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a command, url or state, got %v", v)
+		}
+		if cmd, ok := m["command"]; ok && cmd != nil {
+			args, err := Field{Kind: FieldStrings}.decode(cmd)
+			if err != nil {
+				return nil, fmt.Errorf("command: %v", err)
+			}
+			c.Command = args.([]string)
+		}
+		c.URL, _ = m["url"].(string)
+		c.State, _ = m["state"].(string)
+		if status, ok := m["status"]; ok && status != nil {
+			s, err := Field{Kind: FieldInt}.decode(status)
+			if err != nil {
+				return nil, fmt.Errorf("status: %v", err)
+			}
+			c.Status = s.(int)
+		}
+	}
+	set := 0
+	for _, ok := range []bool{len(c.Command) > 0, len(c.URL) > 0, len(c.State) > 0} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("expected one of command, url or state")
+	}
+	return c, nil
+}
+
+// NewActionIf configure and returns an action checking cond, then running the
+// action described by then when it holds, or the one described by otherwise,
+// if any, when it does not
+func NewActionIf(name string, env Env, cond Condition, then *ActionConfig, otherwise *ActionConfig) (Action, error) {
+	if len(cond.State) > 0 && env.State == nil {
+		return nil, fmt.Errorf("no states to check %s", cond.State)
+	}
+	a := &actionIf{relay: newRelay(name, env.Out), cond: cond, state: env.State}
+	env.Out = a.in
+	var err error
+	if a.then, err = CreateAction(then.Type, name+"#then", env, then.Params); err != nil {
+		a.Stop()
+		return nil, fmt.Errorf("then: %v", err)
+	}
+	if otherwise != nil {
+		if a.otherwise, err = CreateAction(otherwise.Type, name+"#else", env, otherwise.Params); err != nil {
+			a.Stop()
+			return nil, fmt.Errorf("else: %v", err)
+		}
+	}
+	return a, nil
+}
+
+type actionIf struct {
+	*relay
+	cond      Condition
+	state     func(name string) int8
+	then      Action
+	otherwise Action
+}
+
+func (a *actionIf) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *actionIf) ExecuteContext(ctx context.Context) error {
+	ok, err := a.cond.check(ctx, a.state)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return Execute(ctx, a.then)
+	}
+	if a.otherwise != nil {
+		return Execute(ctx, a.otherwise)
+	}
+	return nil
+}
+
+// check returns whether the condition holds, state giving the states of the
+// bindings. Commands which cannot be started are errors, unreachable URLs do
+// not hold.
+func (c Condition) check(ctx context.Context, state func(name string) int8) (bool, error) {
+	switch {
+	case len(c.Command) > 0:
+		cmd := builder.Build(c.Command[0], c.Command[1:]...)
+		_, err := runCommand(ctx, cmd)
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		return err == nil, err
+	case len(c.URL) > 0:
+		req, err := http.NewRequest(http.MethodGet, c.URL, nil)
+		if err != nil {
+			return false, err
+		}
+		resp, err := conditionClient.Do(req.WithContext(ctx))
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if err != nil {
+			return false, nil
+		}
+		resp.Body.Close()
+		if c.Status == 0 {
+			return resp.StatusCode/100 == 2, nil
+		}
+		return resp.StatusCode == c.Status, nil
+	}
+	return state(c.State) == 1, nil
+}
+
+// Stop the branches
+func (a *actionIf) Stop() {
+	if a.then != nil {
+		a.then.Stop()
+	}
+	if a.otherwise != nil {
+		a.otherwise.Stop()
+	}
+	a.close()
+}
@@ -0,0 +1,89 @@
+package pad
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestIf(t *testing.T, env Env, cond map[string]interface{}) (Action, *stepLog) {
+	t.Helper()
+	log := &stepLog{}
+	testSteps["then"] = &stepAction{name: "then", log: log}
+	testSteps["else"] = &stepAction{name: "else", log: log}
+	if env.Out == nil {
+		env.Out = make(chan ActionMessage, 10)
+	}
+	a, err := CreateAction(ActionIf, "K0", env, Params{"if": cond, "then": testStep("then"), "else": testStep("else")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, log
+}
+
+func expectBranch(t *testing.T, a Action, log *stepLog, branch string) {
+	t.Helper()
+	if err := a.Execute(); err != nil {
+		t.Fatalf("Should have passed, got %v", err)
+	}
+	if log.String() != branch {
+		t.Errorf("Expected %s to run, got %q", branch, log)
+	}
+	a.Stop()
+}
+
+func TestIf_Command(t *testing.T) {
+	oldBuilder := builder
+	defer func() { builder = oldBuilder }()
+
+	builder = testActionCommandBuilder{}
+
+	a, log := newTestIf(t, Env{}, map[string]interface{}{"command": []interface{}{"open"}})
+	expectBranch(t, a, log, "then")
+	a, log = newTestIf(t, Env{}, map[string]interface{}{"command": "false"})
+	expectBranch(t, a, log, "else")
+}
+
+func TestIf_URL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	a, log := newTestIf(t, Env{}, map[string]interface{}{"url": server.URL})
+	expectBranch(t, a, log, "then")
+	a, log = newTestIf(t, Env{}, map[string]interface{}{"url": server.URL + "/missing"})
+	expectBranch(t, a, log, "else")
+	a, log = newTestIf(t, Env{}, map[string]interface{}{"url": server.URL + "/missing", "status": float64(404)})
+	expectBranch(t, a, log, "then")
+}
+
+func TestIf_State(t *testing.T) {
+	states := map[string]int8{"K1": 1, "K2": -1}
+	env := Env{State: func(name string) int8 { return states[name] }}
+
+	a, log := newTestIf(t, env, map[string]interface{}{"state": "K1"})
+	expectBranch(t, a, log, "then")
+	a, log = newTestIf(t, env, map[string]interface{}{"state": "K2"})
+	expectBranch(t, a, log, "else")
+}
+
+func TestIf_Config(t *testing.T) {
+	for _, cond := range []interface{}{
+		map[string]interface{}{},
+		map[string]interface{}{"command": "true", "state": "K1"},
+		"K1",
+	} {
+		if err := CheckAction(ActionIf, Params{"if": cond, "then": testStep("then")}); err == nil {
+			t.Errorf("Expected %v to be rejected", cond)
+		}
+	}
+	if err := CheckAction(ActionIf, Params{"if": map[string]interface{}{"state": "K1"}}); err == nil {
+		t.Error("Expected then to be required")
+	}
+	if _, err := CreateAction(ActionIf, "K0", Env{}, Params{"if": map[string]interface{}{"state": "K1"}, "then": testStep("then")}); err == nil {
+		t.Error("Expected a state condition to need the states of the bindings")
+	}
+}
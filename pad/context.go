@@ -0,0 +1,153 @@
+package pad
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os/exec"
+	"time"
+)
+
+// ContextAction is an Action which stops when its context is done, returning
+// the error of the context
+type ContextAction interface {
+	Action
+	ExecuteContext(ctx context.Context) error
+}
+
+// Execute runs a until it returns or ctx is done. Actions which do not
+// implement ContextAction cannot be interrupted: they run to the end, keeping
+// their binding busy, and report the error of ctx if it is done meanwhile.
+func Execute(ctx context.Context, a Action) error {
+	if c, ok := a.(ContextAction); ok {
+		return c.ExecuteContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := a.Execute(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// runCommand runs cmd, killing it when ctx is done, and returns its combined
+// output
+func runCommand(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return out.Bytes(), err
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		return out.Bytes(), ctx.Err()
+	}
+}
+
+// SetTimeout of the action registered as name, none when zero
+func (o *Orchestrator) SetTimeout(name string, d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if d <= 0 {
+		delete(o.timeouts, name)
+		return
+	}
+	o.timeouts[name] = d
+}
+
+// runContext returns the context of a run of the action registered as name
+// within parent, done on its timeout, on UnregisterAction or on Shutdown.
+// cancel must be called once the run is over.
+func (o *Orchestrator) runContext(parent context.Context, name string) (ctx context.Context, cancel func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ctx, stop := context.WithCancel(parent)
+	if d, ok := o.timeouts[name]; ok {
+		ctx, stop = context.WithTimeout(parent, d)
+	}
+	ctx = context.WithValue(ctx, runChainKey{}, append(runChain(parent), name))
+	if parent != o.ctx {
+		go func() {
+			select {
+			case <-o.ctx.Done():
+				stop()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	o.runID++
+	id := o.runID
+	if o.runs[name] == nil {
+		o.runs[name] = make(map[int]context.CancelFunc)
+	}
+	o.runs[name][id] = stop
+	return ctx, func() {
+		stop()
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.runs[name], id)
+		if len(o.runs[name]) == 0 {
+			delete(o.runs, name)
+		}
+	}
+}
+
+// runChainKey is the key of the run chain in the contexts of the runs
+type runChainKey struct{}
+
+// runChain returns the names of the actions running the one of ctx, the
+// outermost first
+func runChain(ctx context.Context) []string {
+	chain, _ := ctx.Value(runChainKey{}).([]string)
+	return chain[:len(chain):len(chain)]
+}
+
+// cancelRuns cancels the runs of the action registered as name
+func (o *Orchestrator) cancelRuns(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, stop := range o.runs[name] {
+		stop()
+	}
+}
+
+// executeAction runs the action registered as name and reports how it ended
+func (o *Orchestrator) executeAction(name string, a Action) {
+	o.executeContext(o.ctx, name, a)
+}
+
+// executeContext runs the action registered as name within parent and
+// reports how it ended
+func (o *Orchestrator) executeContext(parent context.Context, name string, a Action) error {
+	ctx, cancel := o.runContext(parent, name)
+	defer cancel()
+	err := Execute(ctx, a)
+	if err == nil {
+		return nil
+	}
+	e := o.executor(name)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		e.timedOut++
+		log.Printf("%s timed out\n", name)
+	case ctx.Err() == context.Canceled:
+		e.cancelled++
+		log.Printf("%s cancelled\n", name)
+	default:
+		e.failed++
+		log.Printf("%s failed: %v\n", name, err)
+	}
+	return err
+}
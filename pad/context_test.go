@@ -0,0 +1,142 @@
+package pad
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingAction runs until its context is done, or fails right away
+type blockingAction struct {
+	fail    bool
+	started chan bool
+}
+
+func (a *blockingAction) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *blockingAction) ExecuteContext(ctx context.Context) error {
+	if a.fail {
+		return errors.New("failed")
+	}
+	a.started <- true
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (a *blockingAction) Stop() {
+}
+
+func expectStats(t *testing.T, orch *Orchestrator, name string, expected ExecutionStats) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for orch.Executions()[name] != expected && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := orch.Executions()[name]; stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestExecuteAdapter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// slowAction does not take a context
+	if err := Execute(ctx, &slowAction{}); err != context.Canceled {
+		t.Errorf("Expected the run to be cancelled, got %v", err)
+	}
+	if err := Execute(context.Background(), &slowAction{}); err != nil {
+		t.Errorf("Expected the run to succeed, got %v", err)
+	}
+
+	// the binding stays busy until the run is over, even past its timeout
+	orch := NewOchestrator(nil)
+	a := &slowAction{}
+	orch.SetPolicy("K0", Drop)
+	orch.SetTimeout("K0", time.Millisecond)
+	orch.execute("K0", a)
+	time.Sleep(2 * time.Millisecond)
+	orch.execute("K0", a)
+	expectStats(t, orch, "K0", ExecutionStats{Dropped: 1, TimedOut: 1})
+	if runs, _ := a.counts(); runs != 1 {
+		t.Errorf("Expected a single run, got %d", runs)
+	}
+}
+
+func TestTimeoutAndCancel(t *testing.T) {
+	orch := NewOchestrator(nil)
+	a := &blockingAction{started: make(chan bool, 1)}
+	orch.RegisterAction("K0", a)
+	orch.SetTimeout("K0", 20*time.Millisecond)
+	orch.execute("K0", a)
+	<-a.started
+	expectStats(t, orch, "K0", ExecutionStats{TimedOut: 1})
+
+	orch.SetTimeout("K0", 0)
+	orch.execute("K0", a)
+	<-a.started
+	expectStats(t, orch, "K0", ExecutionStats{Running: 1, TimedOut: 1})
+	orch.UnregisterAction("K0")
+	expectStats(t, orch, "K0", ExecutionStats{TimedOut: 1, Cancelled: 1})
+
+	orch.execute("K0", &blockingAction{fail: true})
+	expectStats(t, orch, "K0", ExecutionStats{TimedOut: 1, Cancelled: 1, Failed: 1})
+}
+
+func TestShutdownCancels(t *testing.T) {
+	orch := NewOchestrator(nil)
+	go orch.Run()
+	a := &blockingAction{started: make(chan bool, 1)}
+	orch.execute("K0", a)
+	<-a.started
+	orch.Shutdown()
+	expectStats(t, orch, "K0", ExecutionStats{Cancelled: 1})
+}
+
+// callingAction runs the action registered as name through RunAction
+type callingAction struct {
+	orch *Orchestrator
+	name string
+	err  chan error
+}
+
+func (a *callingAction) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *callingAction) ExecuteContext(ctx context.Context) error {
+	err := a.orch.RunAction(ctx, a.name)
+	a.err <- err
+	return err
+}
+
+func (a *callingAction) Stop() {
+}
+
+func TestRunAction(t *testing.T) {
+	orch := NewOchestrator(nil)
+	errs := make(chan error, 2)
+	orch.RegisterAction("K0", &callingAction{orch: orch, name: "K1", err: errs})
+	orch.RegisterAction("K1", &callingAction{orch: orch, name: "K0", err: errs})
+	orch.execute("K0", orch.action("K0"))
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "K0 > K1") {
+		t.Errorf("Expected K1 not to run K0 again, got %v", err)
+	}
+	if err := <-errs; err == nil {
+		t.Error("Expected K0 to fail with K1")
+	}
+
+	a := &blockingAction{started: make(chan bool, 1)}
+	orch.RegisterAction("K2", a)
+	orch.SetPolicy("K2", Drop)
+	orch.SetTimeout("K2", 100*time.Millisecond)
+	orch.execute("K2", a)
+	<-a.started
+	if err := orch.RunAction(context.Background(), "K2"); err == nil {
+		t.Error("Expected K2 to be dropped while it runs")
+	}
+	expectStats(t, orch, "K2", ExecutionStats{Dropped: 1, TimedOut: 1})
+}
@@ -0,0 +1,71 @@
+package pad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+type ledAction struct {
+	name string
+	out  chan<- ActionMessage
+}
+
+func (a *ledAction) Execute() error {
+	a.out <- ActionMessage{ActionName: a.name, State: 1}
+	return nil
+}
+
+func (a *ledAction) Stop() {
+}
+
+func TestDeviceKey(t *testing.T) {
+	if DeviceKey(DefaultDevice, "K0") != "K0" || DeviceKey("left", "K0") != "left:K0" {
+		t.Error("Unexpected device keys")
+	}
+	if d, k := SplitDeviceKey("left:K0"); d != "left" || k != "K0" {
+		t.Errorf("Expected left and K0, got %s and %s", d, k)
+	}
+	if d, k := SplitDeviceKey("K0"); d != DefaultDevice || k != "K0" {
+		t.Errorf("Expected %s and K0, got %s and %s", DefaultDevice, d, k)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	orch := NewOchestrator(nil)
+	orch.RegisterAction("K0", &ledAction{name: "K0", out: orch.Com})
+	orch.RegisterAction("left:K1", &ledAction{name: "left:K1", out: orch.Com})
+	go orch.Run()
+	defer orch.Shutdown()
+
+	left, right := newTestPort(), newTestPort()
+	orch.AttachDevice("left", protocol.NewLegacyCodec(left))
+	orch.AttachDevice("right", protocol.NewLegacyCodec(right))
+	if len(orch.Devices()) != 2 {
+		t.Fatalf("Expected 2 devices, got %v", orch.Devices())
+	}
+
+	right.pad.Write([]byte("K10\n"))
+	time.Sleep(10 * time.Millisecond)
+	if left.written() != "" || right.written() != "" {
+		t.Errorf("K1 is only bound on left, got '%s' and '%s'", left.written(), right.written())
+	}
+
+	left.pad.Write([]byte("K10\n"))
+	time.Sleep(10 * time.Millisecond)
+	if left.written() != "K11\n" || right.written() != "" {
+		t.Errorf("Expected K1 to light on left only, got '%s' and '%s'", left.written(), right.written())
+	}
+
+	right.pad.Write([]byte("K00\n"))
+	time.Sleep(10 * time.Millisecond)
+	if left.written() != "K11\nK01\n" || right.written() != "K01\n" {
+		t.Errorf("Expected shared K0 to light on both, got '%s' and '%s'", left.written(), right.written())
+	}
+
+	orch.DetachDevice("right")
+	if orch.DeviceState("right") != Disconnected || orch.DeviceState("left") != Connected {
+		t.Error("Expected only right to be detached")
+	}
+}
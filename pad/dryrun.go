@@ -0,0 +1,59 @@
+package pad
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+type dryRunAction struct {
+	name   string
+	action Action
+}
+
+// DryRun wraps an action so that executing it only logs what would be done
+func DryRun(name string, a Action) Action {
+	return &dryRunAction{name: name, action: a}
+}
+
+func (a *dryRunAction) Execute() error {
+	log.Printf("Dry run: %s would execute %s\n", a.name, describe(a.action))
+	return nil
+}
+
+func (a *dryRunAction) Stop() {
+}
+
+func describe(a Action) string {
+	switch a := a.(type) {
+	case *actionType:
+		return fmt.Sprintf("type %v", a.strokes)
+	case *actionMacro:
+		return fmt.Sprintf("macro %v", a.args)
+	case *actionPomodoro:
+		return fmt.Sprintf("pomodoro of %v", a.duration)
+	case *actionTrack:
+		return fmt.Sprintf("track on %s", a.projectLabel)
+	case *actionComposite:
+		var steps []string
+		for _, s := range a.steps {
+			steps = append(steps, describe(s.action))
+		}
+		if a.parallel {
+			return fmt.Sprintf("all of [%s]", strings.Join(steps, ", "))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(steps, ", then "))
+	case *actionHTTP:
+		return fmt.Sprintf("%s %s", a.method, a.url.Root)
+	case *actionScript:
+		return fmt.Sprintf("script %s", a.path)
+	case *actionIf:
+		if a.otherwise == nil {
+			return fmt.Sprintf("if %+v then %s", a.cond, describe(a.then))
+		}
+		return fmt.Sprintf("if %+v then %s else %s", a.cond, describe(a.then), describe(a.otherwise))
+	case *actionToggle:
+		return fmt.Sprintf("toggle %s / %s", describe(a.onAction), describe(a.offAction))
+	}
+	return fmt.Sprintf("%T", a)
+}
@@ -0,0 +1,255 @@
+package pad
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Turn passes the steps of an encoder to a TurnAction
+	Turn Gesture = "turn"
+	// Clockwise fires once per step of an encoder turned clockwise
+	Clockwise Gesture = "cw"
+	// CounterClockwise fires once per step of an encoder turned counter-clockwise
+	CounterClockwise Gesture = "ccw"
+)
+
+// TurnAction is implemented by actions bound to the turn of an encoder
+type TurnAction interface {
+	Action
+	// Turn by delta steps, clockwise when positive, after acceleration,
+	// stopping when ctx is done
+	Turn(ctx context.Context, delta int) error
+}
+
+// ValueAction is implemented by actions bound to an analog input
+type ValueAction interface {
+	Action
+	// SetValue to the position of the input, from 0 to 1023, stopping when
+	// ctx is done
+	SetValue(ctx context.Context, value int) error
+}
+
+// Acceleration of an encoder: every step coming within Window of the previous
+// one counts once more than it, up to Max times. The zero value turns
+// acceleration off.
+type Acceleration struct {
+	Window time.Duration
+	Max    int
+}
+
+// encoderState remembers the last step of an encoder to accelerate the next
+type encoderState struct {
+	last       time.Time
+	multiplier int
+}
+
+// IsEncoder returns true if key names an encoder, E<n>
+func IsEncoder(key string) bool {
+	return strings.HasPrefix(key, "E")
+}
+
+// IsAnalog returns true if key names an analog input, A<n>
+func IsAnalog(key string) bool {
+	return strings.HasPrefix(key, "A")
+}
+
+// SetAcceleration of the encoder key, which may be qualified with a device
+func (o *Orchestrator) SetAcceleration(key string, a Acceleration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if a.Max <= 1 || a.Window <= 0 {
+		delete(o.acceleration, key)
+		return
+	}
+	o.acceleration[key] = a
+}
+
+// accelerate returns the delta of steps on encoder happening at the given time
+func (o *Orchestrator) accelerate(device, encoder string, steps int, at time.Time) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := DeviceKey(device, encoder)
+	a, ok := o.acceleration[id]
+	if !ok {
+		a, ok = o.acceleration[encoder]
+	}
+	s := o.encoders[id]
+	if s == nil {
+		s = new(encoderState)
+		o.encoders[id] = s
+	}
+	if !ok || at.Sub(s.last) > a.Window {
+		s.multiplier = 1
+	} else if s.multiplier < a.Max {
+		s.multiplier++
+	}
+	s.last = at
+	return steps * s.multiplier
+}
+
+// turn dispatches the steps of encoder to the action bound to its turn or,
+// failing that, runs the action bound to the direction once per step
+func (o *Orchestrator) turn(device, encoder string, steps int, at time.Time) {
+	log.Printf("Got: %d steps on %s from %s\n", steps, encoder, device)
+	delta := o.accelerate(device, encoder, steps, at)
+	if delta == 0 {
+		return
+	}
+	q := o.inputQueue(DeviceKey(device, encoder))
+	if name, a := o.resolve(device, GestureKey(encoder, Turn)); a != nil {
+		t, ok := a.(TurnAction)
+		if !ok {
+			log.Printf("%s does not take encoder steps\n", name)
+			return
+		}
+		q.push(func() {
+			o.executeInput(name, &turnRun{TurnAction: t, delta: delta})
+		})
+		return
+	}
+	g := Clockwise
+	if delta < 0 {
+		g, delta = CounterClockwise, -delta
+	}
+	name, a := o.resolve(device, GestureKey(encoder, g))
+	if a == nil {
+		return
+	}
+	for i := 0; i < delta; i++ {
+		q.push(func() {
+			o.executeInput(name, a)
+		})
+	}
+}
+
+// slide passes the value of an analog input to the action bound to it. A
+// slider moves faster than most actions run: the values coming while the
+// action runs are skipped but the last one.
+func (o *Orchestrator) slide(device, input string, value int) {
+	name, a := o.resolve(device, input)
+	if a == nil {
+		return
+	}
+	v, ok := a.(ValueAction)
+	if !ok {
+		log.Printf("%s does not take analog values\n", name)
+		return
+	}
+	o.mu.Lock()
+	o.values[name] = value
+	o.mu.Unlock()
+	o.inputQueue(DeviceKey(device, input)).push(func() {
+		o.mu.Lock()
+		value, pending := o.values[name]
+		delete(o.values, name)
+		o.mu.Unlock()
+		if pending {
+			o.executeInput(name, &valueRun{ValueAction: v, value: value})
+		}
+	})
+}
+
+// executeInput runs a step or a value of the binding name like a press, one
+// run at a time
+func (o *Orchestrator) executeInput(name string, a Action) {
+	e := o.executor(name)
+	busy := o.busyLock(name)
+	busy.Lock()
+	defer busy.Unlock()
+	e.mu.Lock()
+	e.running++
+	e.mu.Unlock()
+	o.executeAction(name, a)
+	e.mu.Lock()
+	e.running--
+	e.mu.Unlock()
+}
+
+// turnRun is a run of a TurnAction with the steps of a turn
+type turnRun struct {
+	TurnAction
+	delta int
+}
+
+func (r *turnRun) Execute() error {
+	return r.ExecuteContext(context.Background())
+}
+
+func (r *turnRun) ExecuteContext(ctx context.Context) error {
+	return r.Turn(ctx, r.delta)
+}
+
+// valueRun is a run of a ValueAction with a value of its input
+type valueRun struct {
+	ValueAction
+	value int
+}
+
+func (r *valueRun) Execute() error {
+	return r.ExecuteContext(context.Background())
+}
+
+func (r *valueRun) ExecuteContext(ctx context.Context) error {
+	return r.SetValue(ctx, r.value)
+}
+
+// inputQueue runs the steps of an encoder or the values of an analog input
+// one after the other, in the order they came
+type inputQueue struct {
+	mu      sync.Mutex
+	pending []func()
+	running bool
+}
+
+func (o *Orchestrator) inputQueue(id string) *inputQueue {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q := o.inputs[id]
+	if q == nil {
+		q = new(inputQueue)
+		o.inputs[id] = q
+	}
+	return q
+}
+
+// push a run at the end of the queue
+func (q *inputQueue) push(run func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, run)
+	if !q.running {
+		q.running = true
+		go q.work()
+	}
+}
+
+func (q *inputQueue) work() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		run := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+		run()
+	}
+}
+
+// busyLock returns the lock serializing the runs of the binding name
+func (o *Orchestrator) busyLock(name string) *sync.Mutex {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	busy := o.busy[name]
+	if busy == nil {
+		busy = new(sync.Mutex)
+		o.busy[name] = busy
+	}
+	return busy
+}
@@ -0,0 +1,132 @@
+package pad
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// inputAction records the steps and values it receives
+type inputAction struct {
+	mu     sync.Mutex
+	deltas []int
+	values []int
+	got    chan bool
+}
+
+func newInputAction() *inputAction {
+	return &inputAction{got: make(chan bool, 10)}
+}
+
+func (a *inputAction) Execute() error {
+	return nil
+}
+
+func (a *inputAction) Stop() {
+}
+
+func (a *inputAction) Turn(ctx context.Context, delta int) error {
+	a.mu.Lock()
+	a.deltas = append(a.deltas, delta)
+	a.mu.Unlock()
+	a.got <- true
+	return nil
+}
+
+func (a *inputAction) SetValue(ctx context.Context, value int) error {
+	a.mu.Lock()
+	a.values = append(a.values, value)
+	a.mu.Unlock()
+	a.got <- true
+	return nil
+}
+
+func (a *inputAction) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-a.got:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the action to receive input")
+		}
+	}
+}
+
+func TestTurn(t *testing.T) {
+	orch := NewOchestrator(nil)
+	a := newInputAction()
+	orch.RegisterAction(GestureKey("E0", Turn), a)
+	orch.SetAcceleration("E0", Acceleration{Window: 50 * time.Millisecond, Max: 3})
+	now := time.Now()
+	for i, at := range []time.Duration{0, 10, 20, 30, 500} {
+		steps := 1
+		if i == 4 {
+			steps = -1
+		}
+		orch.turn(DefaultDevice, "E0", steps, now.Add(at*time.Millisecond))
+		a.wait(t, 1)
+	}
+	expected := []int{1, 2, 3, 3, -1}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, d := range expected {
+		if i >= len(a.deltas) || a.deltas[i] != d {
+			t.Fatalf("Expected deltas %v, got %v", expected, a.deltas)
+		}
+	}
+}
+
+func TestTurnSteps(t *testing.T) {
+	orch := NewOchestrator(nil)
+	cw := &slowAction{}
+	orch.RegisterAction(GestureKey("E0", Clockwise), cw)
+	orch.RegisterAction(GestureKey("E0", CounterClockwise), &slowAction{})
+	orch.turn(DefaultDevice, "E0", 3, time.Now())
+	time.Sleep(100 * time.Millisecond)
+	if runs, overlaps := cw.counts(); runs != 3 || overlaps != 0 {
+		t.Errorf("Expected 3 runs one after the other, got %d with %d overlaps", runs, overlaps)
+	}
+}
+
+func TestSlide(t *testing.T) {
+	orch := NewOchestrator(nil)
+	a := newInputAction()
+	orch.RegisterAction("A0", a)
+	orch.slide(DefaultDevice, "A0", 12)
+	a.wait(t, 1)
+	busy := orch.busyLock("A0")
+	busy.Lock()
+	orch.slide(DefaultDevice, "A0", 100)
+	orch.slide(DefaultDevice, "A0", 200)
+	busy.Unlock()
+	a.wait(t, 1)
+	time.Sleep(50 * time.Millisecond)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.values) != 2 || a.values[0] != 12 || a.values[1] != 200 {
+		t.Errorf("Expected the values in between to be skipped, got %v", a.values)
+	}
+}
+
+// waitingTurn takes encoder steps until its context is done
+type waitingTurn struct {
+	inputAction
+}
+
+func (a *waitingTurn) Turn(ctx context.Context, delta int) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestTurn_Timeout(t *testing.T) {
+	orch := NewOchestrator(nil)
+	orch.RegisterAction(GestureKey("E0", Turn), &waitingTurn{})
+	orch.SetTimeout(GestureKey("E0", Turn), 20*time.Millisecond)
+	orch.turn(DefaultDevice, "E0", 1, time.Now())
+	orch.turn(DefaultDevice, "E0", -1, time.Now())
+	time.Sleep(100 * time.Millisecond)
+	if s := orch.Executions()[GestureKey("E0", Turn)]; s.TimedOut != 2 || s.Running != 0 {
+		t.Errorf("Expected both turns to time out one after the other, got %+v", s)
+	}
+}
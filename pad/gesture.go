@@ -0,0 +1,224 @@
+package pad
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Gesture performed on a key
+type Gesture string
+
+const (
+	// Tap is a short press, bound to the key itself
+	Tap Gesture = "tap"
+	// DoubleTap is two taps within the double tap threshold
+	DoubleTap Gesture = "double_tap"
+	// LongPress fires once the key is held longer than the long press threshold
+	LongPress Gesture = "long_press"
+	// Hold fires as soon as the key goes down
+	Hold Gesture = "hold"
+	// Release fires when the key goes up
+	Release Gesture = "release"
+)
+
+// Gestures other than Tap, which can be bound with GestureKey. Turn,
+// Clockwise and CounterClockwise are the gestures of encoders.
+var Gestures = []Gesture{DoubleTap, LongPress, Hold, Release, Turn, Clockwise, CounterClockwise}
+
+// Thresholds of the gesture detection, zero values use the defaults
+type Thresholds struct {
+	LongPress time.Duration
+	DoubleTap time.Duration
+}
+
+// DefaultThresholds used for keys without thresholds of their own
+var DefaultThresholds = Thresholds{LongPress: 500 * time.Millisecond, DoubleTap: 250 * time.Millisecond}
+
+func (t Thresholds) withDefaults() Thresholds {
+	if t.LongPress <= 0 {
+		t.LongPress = DefaultThresholds.LongPress
+	}
+	if t.DoubleTap <= 0 {
+		t.DoubleTap = DefaultThresholds.DoubleTap
+	}
+	return t
+}
+
+// GestureKey returns the name under which the action of a gesture on key is
+// registered, e.g. K0/double_tap. Taps are bound to the key itself.
+func GestureKey(key string, g Gesture) string {
+	if g == Tap || len(g) == 0 {
+		return key
+	}
+	return key + "/" + string(g)
+}
+
+// SplitGestureKey returns the key and the gesture of a name built by GestureKey
+func SplitGestureKey(name string) (string, Gesture) {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], Gesture(name[i+1:])
+	}
+	return name, Tap
+}
+
+// keyGesture is the detection state of one key of one device
+type keyGesture struct {
+	gen       int
+	down      bool
+	pressedAt time.Time
+	immediate bool
+	long      bool
+	second    bool
+	taps      int
+	timer     *time.Timer
+	// tapped when the tap fired on press, see gestureDetector.momentary
+	tapped bool
+}
+
+func (k *keyGesture) stop() {
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+}
+
+// gestureDetector turns the presses and releases of keys into gestures.
+// bound tells which gestures have an action for a key and thresholds how long
+// to wait for them, emit is called with the detected gestures and whether the
+// key is still held.
+type gestureDetector struct {
+	mu         sync.Mutex
+	keys       map[string]*keyGesture
+	bound      func(device, key string, g Gesture) bool
+	thresholds func(device, key string) Thresholds
+	emit       func(device, key string, g Gesture, held bool)
+	// momentary tells the keys whose tap lasts while they are held, like
+	// momentary layers. Their tap fires on press, the other gestures are
+	// still told apart on top of it.
+	momentary func(device, key string) bool
+}
+
+func newGestureDetector(bound func(string, string, Gesture) bool, thresholds func(string, string) Thresholds, emit func(string, string, Gesture, bool)) *gestureDetector {
+	return &gestureDetector{
+		keys:       make(map[string]*keyGesture),
+		bound:      bound,
+		thresholds: thresholds,
+		emit:       emit,
+	}
+}
+
+// feed a press or a release of key on device, happening at the given time
+func (d *gestureDetector) feed(device, key string, pressed bool, at time.Time) {
+	if pressed {
+		d.press(device, key, at)
+	} else {
+		d.release(device, key, at)
+	}
+}
+
+func (d *gestureDetector) state(device, key string) *keyGesture {
+	id := DeviceKey(device, key)
+	k := d.keys[id]
+	if k == nil {
+		k = new(keyGesture)
+		d.keys[id] = k
+	}
+	return k
+}
+
+func (d *gestureDetector) press(device, key string, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := d.state(device, key)
+	if k.down {
+		return
+	}
+	k.gen++
+	k.down = true
+	k.pressedAt = at
+	k.long = false
+	k.immediate = false
+	k.tapped = d.momentary != nil && d.momentary(device, key)
+	k.second = k.taps == 1
+	k.stop()
+	if d.bound(device, key, Hold) {
+		d.emit(device, key, Hold, true)
+	}
+	if k.tapped {
+		d.emit(device, key, Tap, true)
+	}
+	longPress := d.bound(device, key, LongPress)
+	if !longPress && !d.bound(device, key, DoubleTap) {
+		// Nothing to tell apart, the tap fires right away
+		k.immediate = true
+		k.taps = 0
+		if !k.tapped {
+			d.emit(device, key, Tap, true)
+		}
+		return
+	}
+	if longPress {
+		gen := k.gen
+		k.timer = time.AfterFunc(d.thresholds(device, key).withDefaults().LongPress, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if k.gen != gen || !k.down || k.long {
+				return
+			}
+			k.long = true
+			k.taps = 0
+			d.emit(device, key, LongPress, true)
+		})
+	}
+}
+
+func (d *gestureDetector) release(device, key string, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := d.state(device, key)
+	if !k.down {
+		return
+	}
+	k.down = false
+	k.stop()
+	if d.bound(device, key, Release) {
+		d.emit(device, key, Release, false)
+	}
+	t := d.thresholds(device, key).withDefaults()
+	if !k.long && !k.immediate && at.Sub(k.pressedAt) >= t.LongPress && d.bound(device, key, LongPress) {
+		// The timer did not fire yet but the key was held long enough
+		k.long = true
+		d.emit(device, key, LongPress, false)
+	}
+	if k.immediate || k.long {
+		k.taps = 0
+		return
+	}
+	if k.second {
+		k.taps = 0
+		d.emit(device, key, DoubleTap, false)
+		return
+	}
+	if !d.bound(device, key, DoubleTap) {
+		k.taps = 0
+		if !k.tapped {
+			d.emit(device, key, Tap, false)
+		}
+		return
+	}
+	// Wait for a second tap before firing the first one
+	k.taps = 1
+	gen := k.gen
+	k.timer = time.AfterFunc(t.DoubleTap, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if k.gen != gen || k.taps != 1 {
+			return
+		}
+		k.taps = 0
+		if !k.tapped {
+			d.emit(device, key, Tap, false)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package pad
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestDetector(bound ...Gesture) (*gestureDetector, chan Gesture) {
+	gestures := make(chan Gesture, 10)
+	d := newGestureDetector(func(device, key string, g Gesture) bool {
+		for _, b := range bound {
+			if b == g {
+				return true
+			}
+		}
+		return false
+	}, func(device, key string) Thresholds {
+		return Thresholds{LongPress: 50 * time.Millisecond, DoubleTap: 30 * time.Millisecond}
+	}, func(device, key string, g Gesture, held bool) {
+		gestures <- g
+	})
+	return d, gestures
+}
+
+func expectGestures(t *testing.T, gestures chan Gesture, expected ...Gesture) {
+	t.Helper()
+	for _, e := range expected {
+		select {
+		case g := <-gestures:
+			if g != e {
+				t.Errorf("Expected %s, got %s", e, g)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s, got nothing", e)
+		}
+	}
+	select {
+	case g := <-gestures:
+		t.Errorf("Unexpected %s", g)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestGestureKey(t *testing.T) {
+	if GestureKey("K0", Tap) != "K0" {
+		t.Errorf("Expected taps to be bound to the key, got %s", GestureKey("K0", Tap))
+	}
+	key, g := SplitGestureKey(DeviceKey("left", GestureKey("K0", DoubleTap)))
+	if key != "left:K0" || g != DoubleTap {
+		t.Errorf("Expected left:K0 and %s, got %s and %s", DoubleTap, key, g)
+	}
+}
+
+func TestImmediateTap(t *testing.T) {
+	d, gestures := newTestDetector(Tap, Hold, Release)
+	now := time.Now()
+	d.feed(DefaultDevice, "K0", true, now)
+	expectGestures(t, gestures, Hold, Tap)
+	d.feed(DefaultDevice, "K0", false, now.Add(time.Second))
+	expectGestures(t, gestures, Release)
+}
+
+func TestDoubleTap(t *testing.T) {
+	d, gestures := newTestDetector(Tap, DoubleTap)
+	now := time.Now()
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	expectGestures(t, gestures, DoubleTap)
+
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	expectGestures(t, gestures, Tap)
+}
+
+func TestMomentaryTap(t *testing.T) {
+	d, gestures := newTestDetector(Tap, LongPress, DoubleTap)
+	d.momentary = func(device, key string) bool { return true }
+	now := time.Now()
+	d.feed(DefaultDevice, "K0", true, now)
+	expectGestures(t, gestures, Tap, LongPress)
+	d.feed(DefaultDevice, "K0", false, now.Add(time.Second))
+	expectGestures(t, gestures)
+
+	// The tap does not fire again once the gesture is known
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	expectGestures(t, gestures, Tap, Tap, DoubleTap)
+}
+
+func TestLongPress(t *testing.T) {
+	d, gestures := newTestDetector(Tap, LongPress)
+	now := time.Now()
+	d.feed(DefaultDevice, "K0", true, now)
+	expectGestures(t, gestures, LongPress)
+	d.feed(DefaultDevice, "K0", false, now.Add(time.Second))
+	expectGestures(t, gestures)
+
+	// The timestamps decide when the release comes before the timer
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now.Add(time.Second))
+	expectGestures(t, gestures, LongPress)
+
+	d.feed(DefaultDevice, "K0", true, now)
+	d.feed(DefaultDevice, "K0", false, now)
+	expectGestures(t, gestures, Tap)
+}
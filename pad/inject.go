@@ -0,0 +1,296 @@
+package pad
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Injector sends keystrokes to the focused window
+type Injector interface {
+	Inject(ctx context.Context, strokes []Keystroke) error
+	// Check returns an error when some keystrokes cannot be sent
+	Check(strokes []Keystroke) error
+}
+
+// Injectors are the names of the injectors NewInjector knows
+var Injectors = []string{"cliclick", "xdotool", "ydotool", "wtype", "uinput"}
+
+// NewInjector returns the injector called name, the one DetectInjector finds
+// when empty
+func NewInjector(name string) (Injector, error) {
+	switch name {
+	case "":
+		return DetectInjector(), nil
+	case "cliclick":
+		return cliclick{}, nil
+	case "xdotool":
+		return commandInjector{"xdotool", xdotoolCommand}, nil
+	case "ydotool":
+		return commandInjector{"ydotool", ydotoolCommand}, nil
+	case "wtype":
+		return commandInjector{"wtype", wtypeCommand}, nil
+	case "uinput":
+		return newUinput(), nil
+	}
+	return nil, fmt.Errorf("unknown injector %s, expected one of %s", name, strings.Join(Injectors, ", "))
+}
+
+// lookPath and getenv tell which injector is available, replaced in tests
+var lookPath = exec.LookPath
+var getenv = os.Getenv
+
+// DetectInjector returns the injector of the session: cliclick on macOS,
+// wtype or ydotool on Wayland, xdotool on X11, uinput as a last resort
+func DetectInjector() Injector {
+	candidates := []string{"xdotool", "ydotool", "wtype"}
+	switch {
+	case runtime.GOOS == "darwin":
+		return cliclick{}
+	case len(getenv("WAYLAND_DISPLAY")) > 0:
+		candidates = []string{"wtype", "ydotool"}
+	case len(getenv("DISPLAY")) > 0:
+		candidates = []string{"xdotool", "ydotool"}
+	}
+	for _, name := range candidates {
+		if _, err := lookPath(name); err == nil {
+			i, _ := NewInjector(name)
+			return i
+		}
+	}
+	return newUinput()
+}
+
+// cliclick sends the keystrokes with a single cliclick command
+type cliclick struct{}
+
+func (cliclick) String() string {
+	return "cliclick"
+}
+
+func (cliclick) Inject(ctx context.Context, strokes []Keystroke) error {
+	args, err := cliclickArgs(strokes)
+	if err != nil {
+		return err
+	}
+	return runInjector(ctx, "cliclick", args)
+}
+
+func (cliclick) Check(strokes []Keystroke) error {
+	_, err := cliclickArgs(strokes)
+	return err
+}
+
+func cliclickArgs(strokes []Keystroke) ([]string, error) {
+	var args []string
+	for _, s := range strokes {
+		switch s.Kind {
+		case StrokeText:
+			args = append(args, "t:"+s.Text)
+		case StrokeWait:
+			args = append(args, "w:"+strconv.Itoa(int(s.Wait/time.Millisecond)))
+		case StrokeRaw:
+			args = append(args, s.Text)
+		default:
+			_, k, ok := lookupKey(s.Key)
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("cliclick: unknown key %s", s.Key)
+			case len(k.cliclick) == 0 && s.Kind == StrokePress:
+				// cliclick only presses named keys, characters are typed
+				args = append(args, "t:"+s.Key)
+			case s.Kind == StrokePress:
+				args = append(args, "kp:"+k.cliclick)
+			case !modifiers[k.cliclick]:
+				return nil, fmt.Errorf("cliclick: cannot hold %s, only modifiers", s.Key)
+			case s.Kind == StrokeDown:
+				args = append(args, "kd:"+k.cliclick)
+			default:
+				args = append(args, "ku:"+k.cliclick)
+			}
+		}
+	}
+	return args, nil
+}
+
+// commandInjector runs a command per keystroke, waiting in between
+type commandInjector struct {
+	name    string
+	command func(s Keystroke) ([]string, error)
+}
+
+func (i commandInjector) String() string {
+	return i.name
+}
+
+func (i commandInjector) Inject(ctx context.Context, strokes []Keystroke) (err error) {
+	var held heldKeys
+	defer func() {
+		if err != nil {
+			held.release(func(up Keystroke) error {
+				args, err := i.command(up)
+				if err != nil {
+					return err
+				}
+				return runInjector(context.Background(), args[0], args[1:])
+			})
+		}
+	}()
+	for _, s := range strokes {
+		if s.Kind == StrokeWait {
+			if err = sleep(ctx, s.Wait); err != nil {
+				return err
+			}
+			continue
+		}
+		var args []string
+		if args, err = i.command(s); err != nil {
+			return err
+		}
+		if s.Kind == StrokeDown {
+			// the key may be down even if the command fails
+			held = append(held, s)
+		}
+		if err = runInjector(ctx, args[0], args[1:]); err != nil {
+			return err
+		}
+		if s.Kind == StrokeUp {
+			held = held.up(s)
+		}
+	}
+	return nil
+}
+
+func (i commandInjector) Check(strokes []Keystroke) error {
+	for _, s := range strokes {
+		if s.Kind == StrokeWait {
+			continue
+		}
+		if _, err := i.command(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func xdotoolCommand(s Keystroke) ([]string, error) {
+	if s.Kind == StrokeText {
+		return []string{"xdotool", "type", "--", s.Text}, nil
+	}
+	k, err := injectedKey("xdotool", s)
+	if err != nil || len(k.xkb) == 0 {
+		return nil, orUnsupported(err, "xdotool", s)
+	}
+	command := map[StrokeKind]string{StrokePress: "key", StrokeDown: "keydown", StrokeUp: "keyup"}[s.Kind]
+	return []string{"xdotool", command, k.xkb}, nil
+}
+
+func ydotoolCommand(s Keystroke) ([]string, error) {
+	if s.Kind == StrokeText {
+		return []string{"ydotool", "type", "--", s.Text}, nil
+	}
+	k, err := injectedKey("ydotool", s)
+	if err != nil || k.code == 0 {
+		return nil, orUnsupported(err, "ydotool", s)
+	}
+	code := strconv.Itoa(int(k.code))
+	args := []string{"ydotool", "key"}
+	if s.Kind != StrokeUp {
+		args = append(args, code+":1")
+	}
+	if s.Kind != StrokeDown {
+		args = append(args, code+":0")
+	}
+	return args, nil
+}
+
+// wtypeModifiers are the names of the modifiers for wtype
+var wtypeModifiers = map[string]string{"shift": "shift", "ctrl": "ctrl", "alt": "alt", "cmd": "logo"}
+
+func wtypeCommand(s Keystroke) ([]string, error) {
+	if s.Kind == StrokeText {
+		return []string{"wtype", "--", s.Text}, nil
+	}
+	k, err := injectedKey("wtype", s)
+	if err != nil || len(k.xkb) == 0 {
+		return nil, orUnsupported(err, "wtype", s)
+	}
+	if m, ok := wtypeModifiers[k.cliclick]; ok && s.Kind != StrokePress {
+		if s.Kind == StrokeDown {
+			return []string{"wtype", "-M", m}, nil
+		}
+		return []string{"wtype", "-m", m}, nil
+	}
+	flag := map[StrokeKind]string{StrokePress: "-k", StrokeDown: "-P", StrokeUp: "-p"}[s.Kind]
+	return []string{"wtype", flag, k.xkb}, nil
+}
+
+// injectedKey returns how to send the key of a keystroke, failing on raw
+// cliclick commands
+func injectedKey(injector string, s Keystroke) (namedKey, error) {
+	if s.Kind == StrokeRaw {
+		return namedKey{}, fmt.Errorf("%s: no equivalent to the cliclick command %s", injector, s.Text)
+	}
+	_, k, ok := lookupKey(s.Key)
+	if !ok {
+		return k, fmt.Errorf("%s: unknown key %s", injector, s.Key)
+	}
+	return k, nil
+}
+
+func orUnsupported(err error, injector string, s Keystroke) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: cannot send %s", injector, s.Key)
+}
+
+// heldKeys are the keys an injection pressed down and did not release yet
+type heldKeys []Keystroke
+
+// up removes the key of s, pressed last
+func (h heldKeys) up(s Keystroke) heldKeys {
+	name, _, _ := lookupKey(s.Key)
+	for j := len(h) - 1; j >= 0; j-- {
+		if n, _, _ := lookupKey(h[j].Key); n == name {
+			return append(h[:j:j], h[j+1:]...)
+		}
+	}
+	return h
+}
+
+// release the keys, last pressed first, once an injection stopped halfway.
+// send must not depend on the context of the injection, it may be done.
+func (h heldKeys) release(send func(up Keystroke) error) {
+	for j := len(h) - 1; j >= 0; j-- {
+		up := Keystroke{Kind: StrokeUp, Key: h[j].Key}
+		if err := send(up); err != nil {
+			log.Printf("Could not release %s: %v\n", up.Key, err)
+		}
+	}
+}
+
+// runInjector runs a command of an injector until ctx is done
+func runInjector(ctx context.Context, name string, args []string) error {
+	out, err := runCommand(ctx, builder.Build(name, args...))
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%s (%v)", string(out), err)
+	}
+	return err
+}
+
+// sleep for d unless ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+package pad
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingBuilder records the commands it builds, which all succeed
+type recordingBuilder struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (r *recordingBuilder) Build(command string, args ...string) *exec.Cmd {
+	r.mu.Lock()
+	r.commands = append(r.commands, strings.Join(append([]string{command}, args...), " "))
+	r.mu.Unlock()
+	return testActionCommandBuilder{}.Build("open")
+}
+
+func TestParseCliclick(t *testing.T) {
+	args := []string{"kd:cmd", "t:c", "ku:cmd", "w:500", "kp:return", "c:100,200"}
+	strokes := ParseCliclick(args)
+	expected := []Keystroke{
+		{Kind: StrokeDown, Key: "cmd"},
+		{Kind: StrokeText, Text: "c"},
+		{Kind: StrokeUp, Key: "cmd"},
+		{Kind: StrokeWait, Wait: 500 * time.Millisecond},
+		{Kind: StrokePress, Key: "return"},
+		{Kind: StrokeRaw, Text: "c:100,200"},
+	}
+	if !reflect.DeepEqual(strokes, expected) {
+		t.Errorf("Expected %v, got %v", expected, strokes)
+	}
+	back, err := cliclickArgs(strokes)
+	if err != nil || !reflect.DeepEqual(back, args) {
+		t.Errorf("Expected the cliclick args back, got %v (%v)", back, err)
+	}
+}
+
+func TestInjectors(t *testing.T) {
+	oldBuilder := builder
+	defer func() { builder = oldBuilder }()
+
+	strokes := []Keystroke{
+		{Kind: StrokeDown, Key: "ctrl"},
+		{Kind: StrokePress, Key: "c"},
+		{Kind: StrokeUp, Key: "control"},
+		{Kind: StrokeText, Text: "git"},
+		{Kind: StrokePress, Key: "enter"},
+	}
+	for name, expected := range map[string][]string{
+		"cliclick": {"cliclick kd:ctrl t:c ku:ctrl t:git kp:enter"},
+		"xdotool":  {"xdotool keydown Control_L", "xdotool key c", "xdotool keyup Control_L", "xdotool type -- git", "xdotool key Return"},
+		"ydotool":  {"ydotool key 29:1", "ydotool key 46:1 46:0", "ydotool key 29:0", "ydotool type -- git", "ydotool key 28:1 28:0"},
+		"wtype":    {"wtype -M ctrl", "wtype -k c", "wtype -m ctrl", "wtype -- git", "wtype -k Return"},
+	} {
+		r := &recordingBuilder{}
+		builder = r
+		i, err := NewInjector(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Inject(context.Background(), strokes); err != nil {
+			t.Errorf("%s: should have passed, got %v", name, err)
+		}
+		if !reflect.DeepEqual(r.commands, expected) {
+			t.Errorf("%s: expected %q, got %q", name, expected, r.commands)
+		}
+	}
+
+	builder = &recordingBuilder{}
+	i, _ := NewInjector("xdotool")
+	if err := i.Inject(context.Background(), ParseCliclick([]string{"c:100,200"})); err == nil {
+		t.Error("Expected xdotool to refuse clicks")
+	}
+	if _, err := NewInjector("xdo"); err == nil {
+		t.Error("Expected an unknown injector to be refused")
+	}
+}
+
+// failingBuilder records the commands it builds, fail being the one failing
+type failingBuilder struct {
+	recordingBuilder
+	fail string
+}
+
+func (f *failingBuilder) Build(command string, args ...string) *exec.Cmd {
+	f.recordingBuilder.Build(command, args...)
+	if strings.Join(append([]string{command}, args...), " ") == f.fail {
+		return testActionCommandBuilder{}.Build("false")
+	}
+	return testActionCommandBuilder{}.Build("open")
+}
+
+func TestInjectReleases(t *testing.T) {
+	oldBuilder := builder
+	defer func() { builder = oldBuilder }()
+	f := &failingBuilder{fail: "xdotool key c"}
+	builder = f
+
+	strokes := []Keystroke{
+		{Kind: StrokeDown, Key: "shift"},
+		{Kind: StrokeDown, Key: "ctrl"},
+		{Kind: StrokeUp, Key: "control"},
+		{Kind: StrokeDown, Key: "cmd"},
+		{Kind: StrokePress, Key: "c"},
+		{Kind: StrokeUp, Key: "cmd"},
+	}
+	i, _ := NewInjector("xdotool")
+	if err := i.Inject(context.Background(), strokes); err == nil {
+		t.Error("Expected the injection to fail")
+	}
+	expected := []string{"xdotool keydown Shift_L", "xdotool keydown Control_L", "xdotool keyup Control_L",
+		"xdotool keydown Super_L", "xdotool key c", "xdotool keyup Super_L", "xdotool keyup Shift_L"}
+	if !reflect.DeepEqual(f.commands, expected) {
+		t.Errorf("Expected the keys left down to be released, got %q", f.commands)
+	}
+}
+
+func TestDetectInjector(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("cliclick is always used on macOS")
+	}
+	oldLookPath, oldGetenv := lookPath, getenv
+	defer func() { lookPath, getenv = oldLookPath, oldGetenv }()
+
+	env := map[string]string{}
+	installed := map[string]bool{}
+	getenv = func(name string) string { return env[name] }
+	lookPath = func(name string) (string, error) {
+		if installed[name] {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+	detect := func() string {
+		return DetectInjector().(interface{ String() string }).String()
+	}
+
+	env["DISPLAY"] = ":0"
+	installed["xdotool"] = true
+	installed["ydotool"] = true
+	if i := detect(); i != "xdotool" {
+		t.Errorf("Expected xdotool on X11, got %s", i)
+	}
+	env["WAYLAND_DISPLAY"] = "wayland-0"
+	if i := detect(); i != "ydotool" {
+		t.Errorf("Expected ydotool on Wayland without wtype, got %s", i)
+	}
+	installed = map[string]bool{}
+	if i := detect(); i != "uinput" {
+		t.Errorf("Expected uinput without any tool, got %s", i)
+	}
+}
@@ -0,0 +1,91 @@
+package pad
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+// DefaultDevice is the id of the pad when only one is attached
+const DefaultDevice = "default"
+
+// DeviceKey qualifies key with the device it is bound on, keys of the default
+// device and keys shared by every device are not qualified
+func DeviceKey(device string, key string) string {
+	if device == DefaultDevice || len(device) == 0 {
+		return key
+	}
+	return device + ":" + key
+}
+
+// SplitDeviceKey is the reverse of DeviceKey
+func SplitDeviceKey(name string) (device string, key string) {
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return DefaultDevice, name
+}
+
+// ParseKey splits a key name into its layer and index. Pads with up to ten
+// keys name the keys of upper layers K<layer><index>, e.g. K13 is the fourth
+// key of the second layer.
+func ParseKey(caps protocol.Capabilities, name string) (layer int, index int, err error) {
+	if !strings.HasPrefix(name, "K") {
+		return 0, 0, fmt.Errorf("invalid key name %s", name)
+	}
+	n, err := strconv.Atoi(name[1:])
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("invalid key name %s", name)
+	}
+	if caps.Keys > 10 {
+		return 0, n, nil
+	}
+	return n / 10, n % 10, nil
+}
+
+// CheckKeys returns a warning for every key that does not exist on a pad with
+// the given capabilities
+func CheckKeys(caps protocol.Capabilities, keys []string) []string {
+	var warnings []string
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i > 0 && keys[i-1] == k {
+			continue
+		}
+		if IsEncoder(k) || IsAnalog(k) {
+			if w := checkInput(caps, k); len(w) > 0 {
+				warnings = append(warnings, w)
+			}
+			continue
+		}
+		layer, index, err := ParseKey(caps, k)
+		if err != nil {
+			warnings = append(warnings, err.Error())
+		} else if index >= caps.Keys {
+			warnings = append(warnings, fmt.Sprintf("%s is bound but the pad only has %d keys", k, caps.Keys))
+		} else if layer > 0 && layer >= caps.Layers {
+			warnings = append(warnings, fmt.Sprintf("%s is bound but the pad only has %d layers", k, caps.Layers))
+		}
+	}
+	return warnings
+}
+
+// checkInput returns a warning if the encoder or analog input k does not
+// exist on the pad
+func checkInput(caps protocol.Capabilities, k string) string {
+	n, err := strconv.Atoi(k[1:])
+	if err != nil || n < 0 {
+		return fmt.Sprintf("invalid input name %s", k)
+	}
+	if IsEncoder(k) && n >= caps.Encoders {
+		return fmt.Sprintf("%s is bound but the pad only has %d encoders", k, caps.Encoders)
+	}
+	if IsAnalog(k) && n >= caps.Analog {
+		return fmt.Sprintf("%s is bound but the pad only has %d analog inputs", k, caps.Analog)
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package pad
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+func TestParseKey(t *testing.T) {
+	layer, index, err := ParseKey(protocol.LegacyCapabilities, "K13")
+	if err != nil || layer != 1 || index != 3 {
+		t.Errorf("Expected K13 to be key 3 of layer 1, got %d/%d (%v)", layer, index, err)
+	}
+	layer, index, err = ParseKey(protocol.Capabilities{Keys: 16}, "K13")
+	if err != nil || layer != 0 || index != 13 {
+		t.Errorf("Expected K13 to be key 13 of layer 0, got %d/%d (%v)", layer, index, err)
+	}
+	if _, _, err = ParseKey(protocol.LegacyCapabilities, "P1"); err == nil {
+		t.Error("Expected P1 to be rejected")
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	caps := protocol.Capabilities{Keys: 5, Layers: 1}
+	warnings := CheckKeys(caps, []string{"K0", "K4", "K7", "K12", "Kx"})
+	if len(warnings) != 3 {
+		t.Errorf("Expected 3 warnings, got %v", warnings)
+	}
+	caps = protocol.Capabilities{Keys: 5, Layers: 1, Encoders: 1, Analog: 1}
+	warnings = CheckKeys(caps, []string{"E0", "E1", "A0", "A1", "Ex"})
+	if len(warnings) != 3 {
+		t.Errorf("Expected 3 warnings, got %v", warnings)
+	}
+	keys := []string{"K0", "K9", "K19"}
+	if len(CheckKeys(protocol.LegacyCapabilities, keys)) != 0 {
+		t.Error("Expected every key to exist on a legacy pad")
+	}
+	if strings.Join(keys, ",") != "K0,K9,K19" {
+		t.Errorf("Expected the keys to be left in order, got %v", keys)
+	}
+}
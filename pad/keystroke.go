@@ -0,0 +1,358 @@
+package pad
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StrokeKind tells what a Keystroke does
+type StrokeKind int
+
+const (
+	// StrokeText types the Text of the keystroke
+	StrokeText StrokeKind = iota
+	// StrokePress presses and releases the Key
+	StrokePress
+	// StrokeDown presses the Key, e.g. a modifier, until a StrokeUp
+	StrokeDown
+	// StrokeUp releases the Key
+	StrokeUp
+	// StrokeWait waits for the Wait of the keystroke
+	StrokeWait
+	// StrokeRaw is a cliclick command without an equivalent, e.g. a click,
+	// kept in Text
+	StrokeRaw
+)
+
+// Keystroke is what a Type action sends, translated by the injector in use.
+// Keys are named as cliclick names them (enter, arrow-up, cmd…), or are the
+// unshifted characters of a US keyboard.
+type Keystroke struct {
+	Kind StrokeKind
+	Text string
+	Key  string
+	Wait time.Duration
+}
+
+func (s Keystroke) String() string {
+	switch s.Kind {
+	case StrokeText:
+		return fmt.Sprintf("text %q", s.Text)
+	case StrokePress:
+		return "press " + s.Key
+	case StrokeDown:
+		return "down " + s.Key
+	case StrokeUp:
+		return "up " + s.Key
+	case StrokeWait:
+		return "wait " + s.Wait.String()
+	}
+	return "cliclick " + s.Text
+}
+
+// namedKey is how the injectors name a key: cliclick, xkb for xdotool and
+// wtype, and the Linux input event code for ydotool and uinput. Empty names
+// and zero codes are keys the injector cannot send.
+type namedKey struct {
+	cliclick string
+	xkb      string
+	code     uint16
+}
+
+var namedKeys = map[string]namedKey{
+	"enter":         {"enter", "Return", 28},
+	"return":        {"return", "Return", 28},
+	"space":         {"space", "space", 57},
+	"tab":           {"tab", "Tab", 15},
+	"esc":           {"esc", "Escape", 1},
+	"delete":        {"delete", "BackSpace", 14},
+	"fwd-delete":    {"fwd-delete", "Delete", 111},
+	"home":          {"home", "Home", 102},
+	"end":           {"end", "End", 107},
+	"page-up":       {"page-up", "Prior", 104},
+	"page-down":     {"page-down", "Next", 109},
+	"arrow-up":      {"arrow-up", "Up", 103},
+	"arrow-down":    {"arrow-down", "Down", 108},
+	"arrow-left":    {"arrow-left", "Left", 105},
+	"arrow-right":   {"arrow-right", "Right", 106},
+	"mute":          {"mute", "XF86AudioMute", 113},
+	"volume-down":   {"volume-down", "XF86AudioLowerVolume", 114},
+	"volume-up":     {"volume-up", "XF86AudioRaiseVolume", 115},
+	"play-pause":    {"play-pause", "XF86AudioPlay", 164},
+	"play-next":     {"play-next", "XF86AudioNext", 163},
+	"play-previous": {"play-previous", "XF86AudioPrev", 165},
+	"num-enter":     {"num-enter", "KP_Enter", 96},
+	"num-plus":      {"num-plus", "KP_Add", 78},
+	"num-minus":     {"num-minus", "KP_Subtract", 74},
+	"num-multiply":  {"num-multiply", "KP_Multiply", 55},
+	"num-divide":    {"num-divide", "KP_Divide", 98},
+	"num-equals":    {"num-equals", "KP_Equal", 117},
+	"shift":         {"shift", "Shift_L", 42},
+	"ctrl":          {"ctrl", "Control_L", 29},
+	"alt":           {"alt", "Alt_L", 56},
+	"cmd":           {"cmd", "Super_L", 125},
+	"fn":            {"fn", "", 0},
+}
+
+// keyAliases are the other names of the named keys
+var keyAliases = map[string]string{
+	"escape":    "esc",
+	"backspace": "delete",
+	"del":       "fwd-delete",
+	"pgup":      "page-up",
+	"pgdown":    "page-down",
+	"up":        "arrow-up",
+	"down":      "arrow-down",
+	"left":      "arrow-left",
+	"right":     "arrow-right",
+	"control":   "ctrl",
+	"option":    "alt",
+	"super":     "cmd",
+	"meta":      "cmd",
+	"win":       "cmd",
+}
+
+// modifiers are the keys cliclick can hold down
+var modifiers = map[string]bool{"shift": true, "ctrl": true, "alt": true, "cmd": true, "fn": true}
+
+// charKey is the code of a character on a US keyboard and whether it needs
+// shift
+type charKey struct {
+	code  uint16
+	shift bool
+}
+
+var charKeys = map[rune]charKey{' ': {57, false}, '\n': {28, false}, '\t': {15, false}}
+
+// charSyms are the xkb names of the unshifted punctuation characters
+var charSyms = map[rune]string{
+	'-': "minus", '=': "equal", '[': "bracketleft", ']': "bracketright", ';': "semicolon",
+	'\'': "apostrophe", '`': "grave", '\\': "backslash", ',': "comma", '.': "period", '/': "slash",
+}
+
+func init() {
+	for n := 1; n <= 24; n++ {
+		code := uint16(58 + n)
+		switch {
+		case n > 12:
+			code = uint16(170 + n)
+		case n > 10:
+			code = uint16(76 + n)
+		}
+		name := fmt.Sprintf("f%d", n)
+		namedKeys[name] = namedKey{name, fmt.Sprintf("F%d", n), code}
+	}
+	for n, code := range []uint16{82, 79, 80, 81, 75, 76, 77, 71, 72, 73} {
+		name := fmt.Sprintf("num-%d", n)
+		namedKeys[name] = namedKey{name, fmt.Sprintf("KP_%d", n), code}
+	}
+	// Rows of the US layout, from the code of their first key
+	for _, row := range []struct {
+		code             uint16
+		unshifted, shift string
+	}{
+		{2, "1234567890-=", "!@#$%^&*()_+"},
+		{16, "qwertyuiop[]", "QWERTYUIOP{}"},
+		{30, "asdfghjkl;'`", "ASDFGHJKL:\"~"},
+		{43, "\\zxcvbnm,./", "|ZXCVBNM<>?"},
+	} {
+		for i, c := range row.unshifted {
+			charKeys[c] = charKey{row.code + uint16(i), false}
+		}
+		for i, c := range row.shift {
+			charKeys[c] = charKey{row.code + uint16(i), true}
+		}
+	}
+}
+
+// lookupKey returns the canonical name of a key and how to send it, false
+// when it is unknown
+func lookupKey(name string) (string, namedKey, bool) {
+	name = strings.ToLower(name)
+	if alias, ok := keyAliases[name]; ok {
+		name = alias
+	}
+	if k, ok := namedKeys[name]; ok {
+		return name, k, true
+	}
+	if r := []rune(name); len(r) == 1 {
+		if c, ok := charKeys[r[0]]; ok && !c.shift && r[0] > ' ' {
+			xkb := name
+			if sym, ok := charSyms[r[0]]; ok {
+				xkb = sym
+			}
+			return name, namedKey{xkb: xkb, code: c.code}, true
+		}
+	}
+	return name, namedKey{}, false
+}
+
+// ParseCliclick translates the arguments of cliclick to keystrokes. The
+// commands which are not about the keyboard are kept as raw commands, only
+// cliclick runs them.
+func ParseCliclick(args []string) []Keystroke {
+	var strokes []Keystroke
+	for _, arg := range args {
+		i := strings.Index(arg, ":")
+		if i < 0 {
+			strokes = append(strokes, Keystroke{Kind: StrokeRaw, Text: arg})
+			continue
+		}
+		command, value := arg[:i], arg[i+1:]
+		s := Keystroke{Kind: StrokeRaw, Text: arg}
+		switch command {
+		case "t":
+			s = Keystroke{Kind: StrokeText, Text: value}
+		case "kp", "kd", "ku":
+			name, _, ok := lookupKey(value)
+			if !ok {
+				break
+			}
+			s = Keystroke{Kind: StrokePress, Key: name}
+			if command == "kd" {
+				s.Kind = StrokeDown
+			} else if command == "ku" {
+				s.Kind = StrokeUp
+			}
+		case "w":
+			if ms, err := strconv.Atoi(value); err == nil {
+				s = Keystroke{Kind: StrokeWait, Wait: time.Duration(ms) * time.Millisecond}
+			}
+		}
+		strokes = append(strokes, s)
+	}
+	return strokes
+}
+
+// ParseKeys parses keystrokes written in the keys language of Type actions,
+// items separated by spaces:
+//
+//	"text"         types text, with \", \\, \n and \t escapes
+//	<enter>        presses a named key or a character
+//	<ctrl+shift+t> presses t while holding the modifiers
+//	<wait 500ms>   waits for a duration, in milliseconds without a unit
+//
+// An item followed by *n is repeated n times, e.g. <tab>*3. Errors tell the
+// position of the faulty item, counted in bytes from 1.
+func ParseKeys(s string) ([]Keystroke, error) {
+	var strokes []Keystroke
+	i := 0
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+			i++
+		}
+		if i == len(s) {
+			break
+		}
+		var item []Keystroke
+		var err error
+		switch s[i] {
+		case '"':
+			item, i, err = parseText(s, i)
+		case '<':
+			item, i, err = parseKey(s, i)
+		default:
+			err = fmt.Errorf("at %d: expected \"text\" or <key>, got %q", i+1, s[i:i+1])
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i < len(s) && s[i] == '*' {
+			start := i
+			for i++; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			}
+			n, err := strconv.Atoi(s[start+1 : i])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("at %d: expected a count of at least 1 after *", start+1)
+			}
+			repeated := item
+			for ; n > 1; n-- {
+				item = append(item, repeated...)
+			}
+		}
+		if i < len(s) && s[i] != ' ' && s[i] != '\t' && s[i] != '\n' {
+			return nil, fmt.Errorf("at %d: expected a space between items", i+1)
+		}
+		strokes = append(strokes, item...)
+	}
+	if len(strokes) == 0 {
+		return nil, fmt.Errorf("no keystrokes")
+	}
+	return strokes, nil
+}
+
+// parseText parses the quoted text starting at i and returns where it ends
+func parseText(s string, i int) ([]Keystroke, int, error) {
+	var text strings.Builder
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '"':
+			if text.Len() == 0 {
+				return nil, 0, fmt.Errorf("at %d: empty text", i+1)
+			}
+			return []Keystroke{{Kind: StrokeText, Text: text.String()}}, j + 1, nil
+		case '\\':
+			j++
+			if j == len(s) {
+				break
+			}
+			escaped, ok := map[byte]string{'"': "\"", '\\': "\\", 'n': "\n", 't': "\t"}[s[j]]
+			if !ok {
+				return nil, 0, fmt.Errorf("at %d: unknown escape \\%c", j, s[j])
+			}
+			text.WriteString(escaped)
+		default:
+			text.WriteByte(s[j])
+		}
+	}
+	return nil, 0, fmt.Errorf("at %d: missing \" at the end of the text", i+1)
+}
+
+// parseKey parses the key, chord or wait starting at i and returns where it
+// ends
+func parseKey(s string, i int) ([]Keystroke, int, error) {
+	end := strings.IndexByte(s[i:], '>')
+	if end < 0 {
+		return nil, 0, fmt.Errorf("at %d: missing > at the end of the key", i+1)
+	}
+	inner := strings.TrimSpace(s[i+1 : i+end])
+	next := i + end + 1
+	if strings.HasPrefix(inner, "wait ") {
+		value := strings.TrimSpace(strings.TrimPrefix(inner, "wait "))
+		d, err := time.ParseDuration(value)
+		if ms, msErr := strconv.Atoi(value); msErr == nil {
+			d, err = time.Duration(ms)*time.Millisecond, nil
+		}
+		if err != nil || d < 0 {
+			return nil, 0, fmt.Errorf("at %d: invalid duration %q", i+1, value)
+		}
+		return []Keystroke{{Kind: StrokeWait, Wait: d}}, next, nil
+	}
+	parts := strings.Split(inner, "+")
+	var names []string
+	for j, part := range parts {
+		name, _, ok := lookupKey(strings.TrimSpace(part))
+		switch {
+		case len(name) == 0:
+			return nil, 0, fmt.Errorf("at %d: empty key", i+1)
+		case !ok:
+			return nil, 0, fmt.Errorf("at %d: unknown key %q", i+1, name)
+		case j < len(parts)-1 && !modifiers[name]:
+			return nil, 0, fmt.Errorf("at %d: %q is not a modifier", i+1, name)
+		}
+		names = append(names, name)
+	}
+	key := names[len(names)-1]
+	held := names[:len(names)-1]
+	var strokes []Keystroke
+	for _, m := range held {
+		strokes = append(strokes, Keystroke{Kind: StrokeDown, Key: m})
+	}
+	strokes = append(strokes, Keystroke{Kind: StrokePress, Key: key})
+	for j := len(held) - 1; j >= 0; j-- {
+		strokes = append(strokes, Keystroke{Kind: StrokeUp, Key: held[j]})
+	}
+	return strokes, next, nil
+}
@@ -0,0 +1,91 @@
+package pad
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKeys(t *testing.T) {
+	strokes, err := ParseKeys(`"git \"log\"" <Enter> <ctrl+shift+t> <tab>*2 <wait 500ms> <wait 20>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Keystroke{
+		{Kind: StrokeText, Text: `git "log"`},
+		{Kind: StrokePress, Key: "enter"},
+		{Kind: StrokeDown, Key: "ctrl"},
+		{Kind: StrokeDown, Key: "shift"},
+		{Kind: StrokePress, Key: "t"},
+		{Kind: StrokeUp, Key: "shift"},
+		{Kind: StrokeUp, Key: "ctrl"},
+		{Kind: StrokePress, Key: "tab"},
+		{Kind: StrokePress, Key: "tab"},
+		{Kind: StrokeWait, Wait: 500 * time.Millisecond},
+		{Kind: StrokeWait, Wait: 20 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(strokes, expected) {
+		t.Errorf("Expected %v, got %v", expected, strokes)
+	}
+}
+
+func TestParseKeys_Errors(t *testing.T) {
+	for keys, expected := range map[string]string{
+		``:                  "no keystrokes",
+		`git`:               `at 1: expected "text" or <key>`,
+		`<enter> "oops`:     "at 9: missing \"",
+		`"a" <entr>`:        `at 5: unknown key "entr"`,
+		`<a+b>`:             `at 1: "a" is not a modifier`,
+		`<tab>*0`:           "at 6: expected a count",
+		`<enter`:            "at 1: missing >",
+		`<wait soon>`:       `at 1: invalid duration "soon"`,
+		`<tab><enter>`:      "at 6: expected a space",
+		`"a\q"`:             `at 3: unknown escape \q`,
+		`<ctrl+>`:           "at 1: empty key",
+		`"" <enter>`:        "at 1: empty text",
+		`<enter> <up>*x`:    "at 13: expected a count",
+		`<wait 1s> <f25>`:   `at 11: unknown key "f25"`,
+		`"ok" <cmd+space>x`: "at 17: expected a space",
+	} {
+		_, err := ParseKeys(keys)
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("%s: expected %q, got %v", keys, expected, err)
+		}
+	}
+}
+
+func TestTypeKeys(t *testing.T) {
+	if err := CheckAction(ActionType, Params{"keys": `<ctrl+c>`}); err != nil {
+		t.Errorf("Should have passed, got %v", err)
+	}
+	for _, p := range []Params{
+		{},
+		{"keys": `<ctrl+c>`, "args": []string{"t:c"}},
+		{"keys": `<ctl+c>`},
+	} {
+		if err := CheckAction(ActionType, p); err == nil {
+			t.Errorf("Expected %v to be rejected", p)
+		}
+	}
+
+	oldBuilder := builder
+	defer func() { builder = oldBuilder }()
+	r := &recordingBuilder{}
+	builder = r
+
+	xdotool, _ := NewInjector("xdotool")
+	a, err := CreateAction(ActionType, "K1", Env{Out: make(chan ActionMessage, 2), Injector: xdotool}, Params{"keys": `"ls" <enter>`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"xdotool type -- ls", "xdotool key Return"}; !reflect.DeepEqual(r.commands, expected) {
+		t.Errorf("Expected %q, got %q", expected, r.commands)
+	}
+	if _, err := CreateAction(ActionType, "K1", Env{Injector: xdotool}, Params{"args": []string{"c:10,10"}}); err == nil {
+		t.Error("Expected xdotool to refuse clicks when the action is created")
+	}
+}
@@ -0,0 +1,278 @@
+package pad
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// BaseLayer holds the bindings which are not qualified with a layer
+const BaseLayer = "base"
+
+// LayerMode tells how a layer-switch action activates its layer
+type LayerMode string
+
+const (
+	// Momentary layers are active while their key is held
+	Momentary LayerMode = "momentary"
+	// Toggle layers are switched on and off by their key
+	Toggle LayerMode = "toggle"
+	// OneShot layers are active for the next key only
+	OneShot LayerMode = "one-shot"
+)
+
+// ActionLayer switches layers
+const ActionLayer = "layer"
+
+func init() {
+	RegisterActionKind(ActionKind{
+		Name:  ActionLayer,
+		Label: "Layer",
+		Fields: []Field{
+			{Name: "layer", Kind: FieldString, Label: "Layer", Required: true},
+			{Name: "mode", Kind: FieldChoice, Label: "Mode", Choices: []string{string(Momentary), string(Toggle), string(OneShot)}},
+		},
+		New: func(name string, env Env, p Params) (Action, error) {
+			if env.Layers == nil {
+				return nil, fmt.Errorf("layer actions need the layers of an orchestrator")
+			}
+			return NewActionLayer(name, env.Out, env.Layers, p.String("layer"), LayerMode(p.String("mode")))
+		},
+	})
+}
+
+// LayerKey qualifies key with the layer it is bound on, keys of the base
+// layer are left alone
+func LayerKey(layer string, key string) string {
+	if len(layer) == 0 || layer == BaseLayer {
+		return key
+	}
+	return layer + "." + key
+}
+
+// SplitLayerKey is the reverse of LayerKey
+func SplitLayerKey(name string) (layer string, key string) {
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return BaseLayer, name
+}
+
+// PhysicalKeys returns the keys of the pad behind a binding name, which may
+// be qualified with a device, a layer and a gesture and may be a chord or a
+// leader sequence
+func PhysicalKeys(name string) []string {
+	_, key := SplitDeviceKey(name)
+	_, key = SplitLayerKey(key)
+	key, _ = SplitGestureKey(key)
+	var keys []string
+	for _, k := range strings.Fields(key) {
+		keys = append(keys, ChordKeys(k)...)
+	}
+	if len(keys) == 0 {
+		return []string{key}
+	}
+	return keys
+}
+
+type activeLayer struct {
+	name string
+	mode LayerMode
+}
+
+// Layers is the stack of active layers, shared by every pad. Keys are looked
+// up from the top of the stack down to the layer of the profile, if any, and
+// the base layer.
+type Layers struct {
+	mu       sync.Mutex
+	stack    []activeLayer
+	profile  string
+	watchers map[*actionLayer]bool
+	onChange func()
+}
+
+func newLayers() *Layers {
+	return &Layers{watchers: make(map[*actionLayer]bool)}
+}
+
+// Active returns the active layers, topmost first
+func (l *Layers) Active() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var names []string
+	for i := len(l.stack) - 1; i >= 0; i-- {
+		names = append(names, l.stack[i].name)
+	}
+	if len(l.profile) > 0 && l.index(l.profile) < 0 {
+		names = append(names, l.profile)
+	}
+	return names
+}
+
+// SetProfile makes name the layer right above the base one, none when empty
+func (l *Layers) SetProfile(name string) {
+	l.mu.Lock()
+	changed := l.profile != name
+	l.profile = name
+	l.mu.Unlock()
+	if changed {
+		l.changed()
+	}
+}
+
+// Profile returns the layer of the profile, empty when none is active
+func (l *Layers) Profile() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.profile
+}
+
+// IsActive returns true if the layer is on the stack
+func (l *Layers) IsActive(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.index(name) >= 0
+}
+
+func (l *Layers) index(name string) int {
+	for i, a := range l.stack {
+		if a.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Push activates a layer on top of the stack, moving it there if it was
+// already active
+func (l *Layers) Push(name string, mode LayerMode) {
+	l.mu.Lock()
+	if i := l.index(name); i >= 0 {
+		l.stack = append(l.stack[:i], l.stack[i+1:]...)
+	}
+	l.stack = append(l.stack, activeLayer{name: name, mode: mode})
+	l.mu.Unlock()
+	l.changed()
+}
+
+// Remove deactivates a layer
+func (l *Layers) Remove(name string) {
+	l.mu.Lock()
+	i := l.index(name)
+	if i >= 0 {
+		l.stack = append(l.stack[:i], l.stack[i+1:]...)
+	}
+	l.mu.Unlock()
+	if i >= 0 {
+		l.changed()
+	}
+}
+
+// consumeOneShot deactivates the one-shot layers once a key used them
+func (l *Layers) consumeOneShot() {
+	l.mu.Lock()
+	var stack []activeLayer
+	for _, a := range l.stack {
+		if a.mode != OneShot {
+			stack = append(stack, a)
+		}
+	}
+	consumed := len(stack) != len(l.stack)
+	l.stack = stack
+	l.mu.Unlock()
+	if consumed {
+		l.changed()
+	}
+}
+
+// changed lights the keys of the layer-switch actions of the active layers
+func (l *Layers) changed() {
+	l.mu.Lock()
+	var watchers []*actionLayer
+	for a := range l.watchers {
+		watchers = append(watchers, a)
+	}
+	l.mu.Unlock()
+	for _, a := range watchers {
+		go a.show()
+	}
+	if l.onChange != nil {
+		go l.onChange()
+	}
+}
+
+// holdAction is implemented by actions lasting as long as their key is held
+type holdAction interface {
+	Action
+	Release()
+}
+
+type actionLayer struct {
+	name   string
+	out    chan<- ActionMessage
+	layers *Layers
+	layer  string
+	mode   LayerMode
+}
+
+// NewActionLayer configure and returns an action that switches to layer, its
+// LED shows whether the layer is active
+func NewActionLayer(name string, out chan<- ActionMessage, layers *Layers, layer string, mode LayerMode) (Action, error) {
+	if len(layer) == 0 || layer == BaseLayer || strings.ContainsAny(layer, ".:/+") {
+		return nil, fmt.Errorf("invalid layer name %q", layer)
+	}
+	switch mode {
+	case "":
+		mode = Momentary
+	case Momentary, Toggle, OneShot:
+	default:
+		return nil, fmt.Errorf("unknown layer mode %s", mode)
+	}
+	return &actionLayer{name: name, out: out, layers: layers, layer: layer, mode: mode}, nil
+}
+
+// watch lights the key of the action whenever the layers change, from the
+// moment it is bound to a key until it is stopped
+func (a *actionLayer) watch() {
+	a.layers.mu.Lock()
+	a.layers.watchers[a] = true
+	a.layers.mu.Unlock()
+	go a.show()
+}
+
+func (a *actionLayer) unwatch() {
+	a.layers.mu.Lock()
+	delete(a.layers.watchers, a)
+	a.layers.mu.Unlock()
+}
+
+func (a *actionLayer) Execute() error {
+	if a.mode == Toggle && a.layers.IsActive(a.layer) {
+		a.layers.Remove(a.layer)
+		return nil
+	}
+	a.layers.Push(a.layer, a.mode)
+	return nil
+}
+
+// Release deactivates momentary layers
+func (a *actionLayer) Release() {
+	if a.mode == Momentary {
+		a.layers.Remove(a.layer)
+	}
+}
+
+func (a *actionLayer) Stop() {
+	a.unwatch()
+	if a.mode == Momentary {
+		a.layers.Remove(a.layer)
+	}
+}
+
+func (a *actionLayer) show() {
+	var state int8 = -1
+	if a.layers.IsActive(a.layer) {
+		state = 1
+	}
+	a.out <- ActionMessage{ActionName: a.name, State: state}
+}
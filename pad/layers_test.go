@@ -0,0 +1,143 @@
+package pad
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+func newLayeredOrchestrator(t *testing.T, mode LayerMode) (*Orchestrator, Action, Action) {
+	orch := NewOchestrator(nil)
+	base := &ledAction{name: "K0", out: orch.Com}
+	media := &ledAction{name: "media.K0", out: orch.Com}
+	orch.RegisterAction("K0", base)
+	orch.RegisterAction(LayerKey("media", "K0"), media)
+	switcher, err := NewActionLayer("K4", orch.Com, orch.Layers(), "media", mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orch.RegisterAction("K4", switcher)
+	return orch, base, media
+}
+
+func TestLayerKey(t *testing.T) {
+	if LayerKey(BaseLayer, "K0") != "K0" || LayerKey("media", "K0") != "media.K0" {
+		t.Errorf("Unexpected layer keys %s and %s", LayerKey(BaseLayer, "K0"), LayerKey("media", "K0"))
+	}
+	keys := PhysicalKeys(DeviceKey("left", GestureKey(LayerKey("media", "K0+K3"), DoubleTap)))
+	if strings.Join(keys, ",") != "K0,K3" {
+		t.Errorf("Expected K0 and K3, got %v", keys)
+	}
+	if _, err := NewActionLayer("K4", nil, newLayers(), "a.b", Toggle); err == nil {
+		t.Error("Expected an invalid layer name to be rejected")
+	}
+}
+
+func TestMomentaryLayer(t *testing.T) {
+	orch, base, media := newLayeredOrchestrator(t, Momentary)
+	orch.dispatch(DefaultDevice, "K4", Tap, true)
+	if orch.lookup(DefaultDevice, "K0") != media {
+		t.Error("Expected K0 to be looked up on the media layer")
+	}
+	if orch.lookup(DefaultDevice, "K4") == nil {
+		t.Error("Expected K4 to fall through to the base layer")
+	}
+	if !orch.bound(DefaultDevice, "K4", Release) {
+		t.Error("Expected the release of K4 to be bound while it is held")
+	}
+	orch.dispatch(DefaultDevice, "K4", Release, false)
+	if orch.lookup(DefaultDevice, "K0") != base {
+		t.Error("Expected the media layer to be released with K4")
+	}
+}
+
+func TestMomentaryLayer_Gestures(t *testing.T) {
+	orch, base, media := newLayeredOrchestrator(t, Momentary)
+	orch.RegisterAction(GestureKey("K4", LongPress), &ledAction{name: GestureKey("K4", LongPress), out: orch.Com})
+	orch.SetThresholds("K4", Thresholds{LongPress: 50 * time.Millisecond})
+	now := time.Now()
+	orch.gestures.feed(DefaultDevice, "K4", true, now)
+	if orch.lookup(DefaultDevice, "K0") != media {
+		t.Error("Expected the media layer to be active as soon as K4 is pressed")
+	}
+	orch.gestures.feed(DefaultDevice, "K4", false, now.Add(10*time.Millisecond))
+	if orch.lookup(DefaultDevice, "K0") != base {
+		t.Error("Expected the media layer to be released with K4")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if orch.lookup(DefaultDevice, "K0") != base {
+		t.Error("Expected the media layer to stay released")
+	}
+
+	// fired once the key is up, e.g. by a leader sequence, it does not stick
+	orch.dispatch(DefaultDevice, "K4", Tap, false)
+	if orch.lookup(DefaultDevice, "K0") != base {
+		t.Error("Expected the media layer not to be held without its key")
+	}
+}
+
+func TestToggleAndOneShotLayers(t *testing.T) {
+	orch, base, media := newLayeredOrchestrator(t, Toggle)
+	orch.dispatch(DefaultDevice, "K4", Tap, true)
+	orch.dispatch(DefaultDevice, "K4", Release, false)
+	orch.dispatch(DefaultDevice, "K0", Tap, true)
+	if orch.lookup(DefaultDevice, "K0") != media {
+		t.Error("Expected the media layer to stay active")
+	}
+	orch.dispatch(DefaultDevice, "K4", Tap, true)
+	if orch.lookup(DefaultDevice, "K0") != base {
+		t.Error("Expected the media layer to be toggled off")
+	}
+
+	orch, base, media = newLayeredOrchestrator(t, OneShot)
+	orch.dispatch(DefaultDevice, "K4", Tap, true)
+	orch.dispatch(DefaultDevice, "K4", Release, false)
+	if orch.lookup(DefaultDevice, "K0") != media {
+		t.Error("Expected the media layer to be active for the next key")
+	}
+	orch.RegisterAction(GestureKey("K0", Hold), &ledAction{name: GestureKey("K0", Hold), out: orch.Com})
+	orch.dispatch(DefaultDevice, "K0", Hold, true)
+	if orch.lookup(DefaultDevice, "K0") != media {
+		t.Error("Expected the media layer to outlive the hold of the next key")
+	}
+	orch.dispatch(DefaultDevice, "K0", Tap, true)
+	if orch.lookup(DefaultDevice, "K0") != base {
+		t.Error("Expected the media layer to be used once")
+	}
+}
+
+func TestLayerWatchers(t *testing.T) {
+	orch := NewOchestrator(nil)
+	unbound, _ := NewActionLayer("K4", orch.Com, orch.Layers(), "media", Toggle)
+	if len(orch.layers.watchers) != 0 {
+		t.Error("Expected the action not to light its key before it is bound")
+	}
+	orch.RegisterAction("K4", unbound)
+	bound, _ := NewActionLayer("K4", orch.Com, orch.Layers(), "media", Toggle)
+	orch.RegisterAction("K4", bound)
+	if len(orch.layers.watchers) != 1 || !orch.layers.watchers[bound.(*actionLayer)] {
+		t.Errorf("Expected only the bound action to light its key, got %v", orch.layers.watchers)
+	}
+	orch.UnregisterAction("K4")
+	if len(orch.layers.watchers) != 0 {
+		t.Error("Expected the stopped action not to light its key anymore")
+	}
+}
+
+func TestHardwareLayer(t *testing.T) {
+	orch := NewOchestrator(nil)
+	orch.caps[DefaultDevice] = protocol.LegacyCapabilities
+	base := &ledAction{name: "K3", out: orch.Com}
+	raised := &ledAction{name: "1.K2", out: orch.Com}
+	legacy := &ledAction{name: "K11", out: orch.Com}
+	orch.RegisterAction("K3", base)
+	orch.RegisterAction("1.K2", raised)
+	orch.RegisterAction("K11", legacy)
+	for key, expected := range map[string]Action{"K12": raised, "K11": legacy, "K13": base} {
+		if orch.lookup(DefaultDevice, key) != expected {
+			t.Errorf("Unexpected action for %s", key)
+		}
+	}
+}
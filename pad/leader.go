@@ -0,0 +1,176 @@
+package pad
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLeaderTimeout is how long to wait for the next key of a sequence
+const DefaultLeaderTimeout = time.Second
+
+// SequenceKey returns the name of the binding of a leader sequence, its keys
+// separated by spaces starting with the leader key, e.g. "K4 K1 K2"
+func SequenceKey(keys ...string) string {
+	return strings.Join(keys, " ")
+}
+
+// IsSequence returns true if name binds a leader sequence
+func IsSequence(name string) bool {
+	return strings.Contains(name, " ")
+}
+
+// sequenceNode is a node of the trie of the sequences following the leader
+// key, name is set when a sequence ends there
+type sequenceNode struct {
+	name     string
+	children map[string]*sequenceNode
+}
+
+func newSequenceTrie(sequences []string) *sequenceNode {
+	root := &sequenceNode{children: make(map[string]*sequenceNode)}
+	for _, s := range sequences {
+		n := root
+		for _, k := range strings.Fields(s)[1:] {
+			c := n.children[k]
+			if c == nil {
+				c = &sequenceNode{children: make(map[string]*sequenceNode)}
+				n.children[k] = c
+			}
+			n = c
+		}
+		n.name = s
+	}
+	return root
+}
+
+// leaderState is the sequence in progress on a device
+type leaderState struct {
+	gen     int
+	active  bool
+	node    *sequenceNode
+	timer   *time.Timer
+	swallow map[string]bool
+}
+
+// leaderDetector recognises the sequences typed after the leader key and
+// passes the other keys to next. sequences lists the sequences bound on a
+// device, indicate lights the leader key while a sequence is in progress and
+// fire runs the binding of a complete sequence.
+type leaderDetector struct {
+	mu        sync.Mutex
+	key       string
+	timeout   time.Duration
+	devices   map[string]*leaderState
+	sequences func(device string, leader string) []string
+	indicate  func(device, key string, on bool)
+	fire      func(device, name string)
+	next      func(device, key string, pressed bool, at time.Time)
+}
+
+func newLeaderDetector(sequences func(string, string) []string, indicate func(string, string, bool), fire func(string, string), next func(string, string, bool, time.Time)) *leaderDetector {
+	return &leaderDetector{
+		timeout:   DefaultLeaderTimeout,
+		devices:   make(map[string]*leaderState),
+		sequences: sequences,
+		indicate:  indicate,
+		fire:      fire,
+		next:      next,
+	}
+}
+
+func (d *leaderDetector) setLeader(key string, timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if timeout <= 0 {
+		timeout = DefaultLeaderTimeout
+	}
+	d.key = key
+	d.timeout = timeout
+}
+
+func (d *leaderDetector) state(device string) *leaderState {
+	s := d.devices[device]
+	if s == nil {
+		s = &leaderState{swallow: make(map[string]bool)}
+		d.devices[device] = s
+	}
+	return s
+}
+
+// feed a press or a release of key on device
+func (d *leaderDetector) feed(device, key string, pressed bool, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.state(device)
+	if !pressed {
+		if s.swallow[key] {
+			delete(s.swallow, key)
+			return
+		}
+		d.next(device, key, false, at)
+		return
+	}
+	if !s.active {
+		if len(d.key) == 0 || key != d.key {
+			d.next(device, key, true, at)
+			return
+		}
+		trie := newSequenceTrie(d.sequences(device, d.key))
+		if len(trie.children) == 0 {
+			d.next(device, key, true, at)
+			return
+		}
+		s.active = true
+		s.node = trie
+		s.swallow[key] = true
+		d.indicate(device, d.key, true)
+		d.wait(device, s)
+		return
+	}
+	s.swallow[key] = true
+	n := s.node.children[key]
+	switch {
+	case n == nil:
+		log.Printf("No sequence bound after %s on %s\n", key, device)
+		d.end(device, s, "")
+	case len(n.children) == 0:
+		d.end(device, s, n.name)
+	default:
+		// Either a prefix or a sequence which a longer one extends
+		s.node = n
+		d.wait(device, s)
+	}
+}
+
+// wait for the next key of the sequence, firing the sequence typed so far on
+// timeout if it is complete
+func (d *leaderDetector) wait(device string, s *leaderState) {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.gen++
+	gen := s.gen
+	s.timer = time.AfterFunc(d.timeout, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if s.gen == gen && s.active {
+			d.end(device, s, s.node.name)
+		}
+	})
+}
+
+func (d *leaderDetector) end(device string, s *leaderState, name string) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.gen++
+	s.active = false
+	s.node = nil
+	d.indicate(device, d.key, false)
+	if len(name) > 0 {
+		d.fire(device, name)
+	}
+}
@@ -0,0 +1,64 @@
+package pad
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLeader(sequences ...string) (*leaderDetector, chan string) {
+	events := make(chan string, 10)
+	d := newLeaderDetector(func(device, leader string) []string {
+		return sequences
+	}, func(device, key string, on bool) {
+		if on {
+			events <- key + " on"
+		} else {
+			events <- key + " off"
+		}
+	}, func(device, name string) {
+		events <- name
+	}, func(device, key string, pressed bool, at time.Time) {
+		if pressed {
+			events <- key + " down"
+		}
+	})
+	d.setLeader("K4", 30*time.Millisecond)
+	return d, events
+}
+
+func tap(d *leaderDetector, keys ...string) {
+	for _, k := range keys {
+		d.feed(DefaultDevice, k, true, time.Now())
+		d.feed(DefaultDevice, k, false, time.Now())
+	}
+}
+
+func TestSequenceKey(t *testing.T) {
+	name := SequenceKey("K4", "K1", "K2")
+	if name != "K4 K1 K2" || !IsSequence(name) || IsSequence("K4") {
+		t.Errorf("Unexpected sequence %s", name)
+	}
+}
+
+func TestLeaderSequence(t *testing.T) {
+	d, events := newTestLeader("K4 K1 K2", "K4 K3")
+	tap(d, "K4", "K1", "K2")
+	expectInputs(t, events, "K4 on", "K4 off", "K4 K1 K2")
+
+	tap(d, "K0")
+	expectInputs(t, events, "K0 down")
+
+	// Unknown sequences are dropped
+	tap(d, "K4", "K0", "K3")
+	expectInputs(t, events, "K4 on", "K4 off", "K3 down")
+
+	// Timeout
+	tap(d, "K4", "K1")
+	expectInputs(t, events, "K4 on", "K4 off")
+}
+
+func TestLeaderPrefixSequence(t *testing.T) {
+	d, events := newTestLeader("K4 K1", "K4 K1 K2")
+	tap(d, "K4", "K1")
+	expectInputs(t, events, "K4 on", "K4 off", "K4 K1")
+}
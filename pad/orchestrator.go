@@ -1,93 +1,548 @@
 package pad
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/hlidotbe/macropad/focus"
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+// ConnectionState of the link between the orchestrator and the pad
+type ConnectionState int
+
+const (
+	// Disconnected means no pad is attached, LED updates are only remembered
+	Disconnected ConnectionState = iota
+	// Connected means a pad is attached and receives LED updates
+	Connected
 )
 
+func (s ConnectionState) String() string {
+	if s == Connected {
+		return "connected"
+	}
+	return "disconnected"
+}
+
 // Orchestrator processes input from serial connexion and execute corresponding actions
 type Orchestrator struct {
 	// Com channel for ActionMessages
-	Com       chan ActionMessage
-	actions   map[string]Action
-	serialIn  *bufio.Reader
-	serialOut io.Writer
-	input     chan string
-	done      chan bool
+	Com      chan ActionMessage
+	actions  map[string]Action
+	input    chan keyEvent
+	done     chan bool
+	shutdown sync.Once
+	mu       sync.Mutex
+	links    map[string]*link
+	states   map[string]int8
+	progress map[string]byte
+	caps     map[string]protocol.Capabilities
+	// thresholds of the gesture detection per key, which may be qualified
+	thresholds map[string]Thresholds
+	gestures   *gestureDetector
+	chords     *chordDetector
+	leader     *leaderDetector
+	layers     *Layers
+	// held are the actions lasting until the release of their key
+	held     map[string][]holdAction
+	repeats  map[string]Repeat
+	busy     map[string]*sync.Mutex
+	profiles []Profile
+	focused  focus.Window
+	// acceleration of the encoders per key, which may be qualified
+	acceleration map[string]Acceleration
+	encoders     map[string]*encoderState
+	// values of the analog inputs waiting for their action, per binding
+	values map[string]int
+	// inputs run the steps and values of each encoder and analog input in order
+	inputs    map[string]*inputQueue
+	executors map[string]*executor
+	// ctx is the parent of the contexts of the runs, cancelled on Shutdown
+	ctx      context.Context
+	cancel   context.CancelFunc
+	timeouts map[string]time.Duration
+	runs     map[string]map[int]context.CancelFunc
+	runID    int
+}
+
+type link struct {
+	device string
+	codec  protocol.Codec
+	done   chan bool
+}
+
+// keyEvent is a message received from a device
+type keyEvent struct {
+	device string
+	msg    *protocol.Message
+	at     time.Time
 }
 
-// NewOchestrator returns a configured orchestrator ready to be Run
+// NewOchestrator returns a configured orchestrator ready to be Run. serial
+// may be nil, in which case the pad is attached later on with Attach.
 func NewOchestrator(serial io.ReadWriter) *Orchestrator {
 	o := &Orchestrator{
-		Com:       make(chan ActionMessage, 10),
-		serialIn:  bufio.NewReader(serial),
-		serialOut: serial,
-		input:     make(chan string, 10),
-		done:      make(chan bool),
-		actions:   make(map[string]Action),
-	}
-	go o.readLines()
+		Com:      make(chan ActionMessage, 10),
+		input:    make(chan keyEvent, 10),
+		done:     make(chan bool),
+		actions:  make(map[string]Action),
+		links:    make(map[string]*link),
+		states:   make(map[string]int8),
+		progress: make(map[string]byte),
+		caps:     make(map[string]protocol.Capabilities),
+
+		thresholds: make(map[string]Thresholds),
+		layers:     newLayers(),
+		held:       make(map[string][]holdAction),
+		repeats:    make(map[string]Repeat),
+		busy:       make(map[string]*sync.Mutex),
+
+		acceleration: make(map[string]Acceleration),
+		encoders:     make(map[string]*encoderState),
+		values:       make(map[string]int),
+		inputs:       make(map[string]*inputQueue),
+		executors:    make(map[string]*executor),
+		timeouts:     make(map[string]time.Duration),
+		runs:         make(map[string]map[int]context.CancelFunc),
+	}
+	o.ctx, o.cancel = context.WithCancel(context.Background())
+	o.layers.onChange = o.refresh
+	o.gestures = newGestureDetector(o.bound, o.keyThresholds, o.dispatch)
+	o.gestures.momentary = o.momentary
+	o.chords = newChordDetector(o.boundChords, o.gestures.feed)
+	o.leader = newLeaderDetector(o.boundSequences, o.indicate, func(device, name string) {
+		o.dispatch(device, name, Tap, false)
+	}, o.chords.feed)
+	if serial != nil {
+		o.Attach(serial)
+	}
 	return o
 }
 
 // Run the orchestrator
 func (o *Orchestrator) Run() {
 	var msg ActionMessage
-	var line string
+	var in keyEvent
 	for {
 		select {
-		case line = <-o.input:
-			go o.executeAction(line)
+		case in = <-o.input:
+			switch in.msg.Type {
+			case protocol.Key:
+				o.leader.feed(in.device, in.msg.Key, in.msg.Pressed(), in.at)
+			case protocol.Encoder:
+				o.turn(in.device, in.msg.Key, in.msg.Value, in.at)
+			case protocol.Analog:
+				o.slide(in.device, in.msg.Key, in.msg.Value)
+			}
 			break
 		case msg = <-o.Com:
 			go o.notifyIfNeeded(msg)
 			o.updateState(msg)
-			if IsAProgressAction(o.actions[msg.ActionName]) {
+			if IsAProgressAction(o.action(msg.ActionName)) {
 				o.updateProgress(msg)
 			}
 			break
 		case <-o.done:
+			o.Detach()
 			close(o.Com)
-			close(o.input)
 			return
 		}
 	}
 }
 
-// Shutdown the orchestrator and cleanup everything
+// Shutdown the orchestrator and cleanup everything. It can be called more
+// than once, whether Run is running or not.
 func (o *Orchestrator) Shutdown() {
-	o.done <- true
+	o.shutdown.Do(func() {
+		o.cancel()
+		close(o.done)
+	})
+}
+
+// Attach a pad speaking the legacy protocol as the default device, see AttachDevice
+func (o *Orchestrator) Attach(serial io.ReadWriter) <-chan bool {
+	return o.AttachDevice(DefaultDevice, protocol.NewLegacyCodec(serial))
+}
+
+// AttachCodec attaches a pad as the default device, see AttachDevice
+func (o *Orchestrator) AttachCodec(codec protocol.Codec) <-chan bool {
+	return o.AttachDevice(DefaultDevice, codec)
+}
+
+// AttachDevice attaches a pad to the orchestrator, replacing the device with
+// the same id if any. The LED states are sent again to the pad and the bound
+// keys are checked against its capabilities. The returned channel is closed
+// when the link drops, either on a read or write error or on Detach.
+func (o *Orchestrator) AttachDevice(device string, codec protocol.Codec) <-chan bool {
+	caps, err := protocol.CapabilitiesOf(codec)
+	if err != nil {
+		log.Printf("Ignoring capabilities of %s (%v)\n", device, err)
+		caps = protocol.LegacyCapabilities
+	}
+	l := &link{device: device, codec: codec, done: make(chan bool)}
+	o.mu.Lock()
+	if old := o.links[device]; old != nil {
+		close(old.done)
+	}
+	o.links[device] = l
+	o.caps[device] = caps
+	var keys []string
+	seen := make(map[string]bool)
+	for name := range o.actions {
+		if d, _ := SplitDeviceKey(name); d != device && d != DefaultDevice {
+			continue
+		}
+		for _, k := range PhysicalKeys(name) {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	o.mu.Unlock()
+	log.Printf("Pad %s connected (protocol version %d, firmware %s, %d keys, %d layers)\n", device, codec.Version(), caps.Firmware, caps.Keys, caps.Layers)
+	for _, w := range CheckKeys(caps, keys) {
+		log.Printf("Warning: %s: %s\n", device, w)
+	}
+	go o.readMessages(l)
+	o.resync(l)
+	return l.done
+}
+
+// Detach every pad
+func (o *Orchestrator) Detach() {
+	for _, d := range o.Devices() {
+		o.DetachDevice(d)
+	}
+}
+
+// DetachDevice detaches the pad with the given id, if any
+func (o *Orchestrator) DetachDevice(device string) {
+	o.mu.Lock()
+	l := o.links[device]
+	o.mu.Unlock()
+	if l != nil {
+		o.drop(l, nil)
+	}
+}
+
+// Devices returns the ids of the attached pads
+func (o *Orchestrator) Devices() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var devices []string
+	for d := range o.links {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// ConnectionState returns whether at least one pad is attached
+func (o *Orchestrator) ConnectionState() ConnectionState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.links) == 0 {
+		return Disconnected
+	}
+	return Connected
+}
+
+// DeviceState returns whether the pad with the given id is attached
+func (o *Orchestrator) DeviceState(device string) ConnectionState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.links[device] == nil {
+		return Disconnected
+	}
+	return Connected
+}
+
+// Capabilities of the default device, see DeviceCapabilities
+func (o *Orchestrator) Capabilities() protocol.Capabilities {
+	return o.DeviceCapabilities(DefaultDevice)
+}
+
+// DeviceCapabilities of an attached pad, or of the last one attached with
+// that id when disconnected
+func (o *Orchestrator) DeviceCapabilities(device string) protocol.Capabilities {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	caps, ok := o.caps[device]
+	if !ok {
+		return protocol.LegacyCapabilities
+	}
+	return caps
+}
+
+func (o *Orchestrator) drop(l *link, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.links[l.device] != l {
+		return
+	}
+	delete(o.links, l.device)
+	close(l.done)
+	if err != nil {
+		log.Printf("Pad %s disconnected (%v)\n", l.device, err)
+	} else {
+		log.Printf("Pad %s disconnected\n", l.device)
+	}
 }
 
-func (o *Orchestrator) readLines() {
+func (o *Orchestrator) readMessages(l *link) {
 	for {
-		line, _, err := o.serialIn.ReadLine()
-		if err == nil {
-			o.input <- strings.Trim(string(line), "\n")
+		m, err := l.codec.ReadMessage()
+		if err != nil {
+			o.drop(l, err)
+			return
+		}
+		select {
+		case o.input <- keyEvent{device: l.device, msg: m, at: time.Now()}:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (o *Orchestrator) write(l *link, m *protocol.Message) {
+	if err := l.codec.WriteMessage(m); err != nil {
+		o.drop(l, err)
+	}
+}
+
+// shows returns true if the LED of name is shown on key of the given link:
+// device keys are shown on their device, shared keys on every device that
+// does not bind the key itself. Must be called with the lock held.
+func (o *Orchestrator) shows(l *link, name string) (string, bool) {
+	device, _ := SplitDeviceKey(name)
+	// Layers and gestures light the LED of their key, chords the one of
+	// their first key
+	key := PhysicalKeys(name)[0]
+	if device != DefaultDevice {
+		return key, device == l.device
+	}
+	if l.device == DefaultDevice {
+		return key, true
+	}
+	_, own := o.actions[DeviceKey(l.device, key)]
+	return key, !own
+}
+
+// send a message built for each pad showing name
+func (o *Orchestrator) send(name string, build func(key string) *protocol.Message) {
+	type target struct {
+		l   *link
+		key string
+	}
+	var targets []target
+	o.mu.Lock()
+	for _, l := range o.links {
+		if key, ok := o.shows(l, name); ok {
+			targets = append(targets, target{l, key})
 		}
 	}
+	o.mu.Unlock()
+	for _, t := range targets {
+		o.write(t.l, build(t.key))
+	}
+}
 
+// resync sends the remembered LED states and progresses to the pad
+func (o *Orchestrator) resync(l *link) {
+	o.mu.Lock()
+	var msgs []*protocol.Message
+	for name, state := range o.states {
+		if key, ok := o.shows(l, name); ok {
+			msgs = append(msgs, stateMessage(key, state))
+		}
+	}
+	for name, p := range o.progress {
+		if key, ok := o.shows(l, name); ok {
+			msgs = append(msgs, progressMessage(key, p))
+		}
+	}
+	o.mu.Unlock()
+	for _, m := range msgs {
+		o.write(l, m)
+	}
 }
 
 // RegisterAction for given key
 func (o *Orchestrator) RegisterAction(key string, a Action) {
+	o.mu.Lock()
+	old := o.actions[key]
 	o.actions[key] = a
+	o.mu.Unlock()
+	if l, ok := old.(*actionLayer); ok && old != a {
+		l.unwatch()
+	}
+	if l, ok := a.(*actionLayer); ok {
+		l.watch()
+	}
 }
 
-// UnregisterAction for given key, stopping it if it exists
+// UnregisterAction for given key, cancelling its runs and stopping it if it
+// exists
 func (o *Orchestrator) UnregisterAction(key string) Action {
+	o.cancelRuns(key)
+	o.mu.Lock()
 	a := o.actions[key]
+	delete(o.actions, key)
+	o.mu.Unlock()
 	if a != nil {
 		a.Stop()
-		delete(o.actions, key)
 	}
 	return a
 }
 
+// SetThresholds of the gesture detection on key, which may be qualified with
+// a device. Zero values fall back to DefaultThresholds.
+func (o *Orchestrator) SetThresholds(key string, t Thresholds) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if t == (Thresholds{}) {
+		delete(o.thresholds, key)
+		return
+	}
+	o.thresholds[key] = t
+}
+
+func (o *Orchestrator) keyThresholds(device, key string) Thresholds {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if t, ok := o.thresholds[DeviceKey(device, key)]; ok {
+		return t
+	}
+	return o.thresholds[key]
+}
+
+// SetChordWindow sets how long the keys of a chord have to be pressed
+// together, DefaultChordWindow when zero
+func (o *Orchestrator) SetChordWindow(w time.Duration) {
+	o.chords.setWindow(w)
+}
+
+// SetLeader designates the key starting leader sequences and how long to wait
+// for the next key of a sequence, DefaultLeaderTimeout when zero
+func (o *Orchestrator) SetLeader(key string, timeout time.Duration) {
+	o.leader.setLeader(key, timeout)
+}
+
+// boundSequences returns the sequences starting with leader bound on device,
+// shared or its own, on the base layer or an active one
+func (o *Orchestrator) boundSequences(device string, leader string) []string {
+	active := make(map[string]bool)
+	for _, l := range o.layers.Active() {
+		active[l] = true
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var sequences []string
+	for name := range o.actions {
+		d, key := SplitDeviceKey(name)
+		layer, key := SplitLayerKey(key)
+		if (d != device && d != DefaultDevice) || (layer != BaseLayer && !active[layer]) {
+			continue
+		}
+		if keys := strings.Fields(key); len(keys) > 1 && keys[0] == leader {
+			sequences = append(sequences, key)
+		}
+	}
+	return sequences
+}
+
+// indicate lights key on device while a leader sequence is in progress, and
+// shows the state of the action bound there again afterwards
+func (o *Orchestrator) indicate(device, key string, on bool) {
+	o.mu.Lock()
+	l := o.links[device]
+	var state int8 = -1
+	if on {
+		state = 1
+	} else if l != nil {
+		for name, s := range o.states {
+			if k, ok := o.shows(l, name); ok && k == key {
+				state = s
+			}
+		}
+	}
+	o.mu.Unlock()
+	if l != nil {
+		o.write(l, stateMessage(key, state))
+	}
+}
+
+// Layers returns the layer stack of the orchestrator
+func (o *Orchestrator) Layers() *Layers {
+	return o.layers
+}
+
+// boundChords returns the chords bound on device, shared or its own, on the
+// base layer or an active one
+func (o *Orchestrator) boundChords(device string) []chord {
+	active := make(map[string]bool)
+	for _, l := range o.layers.Active() {
+		active[l] = true
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	seen := make(map[string]bool)
+	var chords []chord
+	for name := range o.actions {
+		d, key := SplitDeviceKey(name)
+		layer, key := SplitLayerKey(key)
+		key, _ = SplitGestureKey(key)
+		if (d != device && d != DefaultDevice) || !IsChord(key) || seen[key] {
+			continue
+		}
+		if layer != BaseLayer && !active[layer] {
+			continue
+		}
+		seen[key] = true
+		c := chord{name: key, keys: make(map[string]bool)}
+		for _, k := range ChordKeys(key) {
+			c.keys[k] = true
+		}
+		chords = append(chords, c)
+	}
+	return chords
+}
+
+// bound returns true if an action is bound to the gesture on key
+func (o *Orchestrator) bound(device, key string, g Gesture) bool {
+	if g == Release {
+		o.mu.Lock()
+		held := len(o.held[DeviceKey(device, key)]) > 0
+		o.mu.Unlock()
+		if held {
+			return true
+		}
+	}
+	return o.lookup(device, GestureKey(key, g)) != nil
+}
+
+// momentary tells whether the tap of key on device lasts while it is held
+func (o *Orchestrator) momentary(device, key string) bool {
+	l, ok := o.lookup(device, key).(*actionLayer)
+	return ok && l.mode == Momentary
+}
+
+func (o *Orchestrator) action(key string) Action {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.actions[key]
+}
+
 func (o *Orchestrator) notifyIfNeeded(msg ActionMessage) {
 	if len(msg.Notify) == 0 {
 		return
@@ -99,34 +554,225 @@ func (o *Orchestrator) notifyIfNeeded(msg ActionMessage) {
 	}
 }
 
-func (o *Orchestrator) executeAction(line string) {
-	if line[len(line)-1] == '1' {
-		return
+// lookup the action bound to name, a key with an optional gesture, on
+// device. Keys of the upper layers of a pad (K13) are looked up on that layer
+// first (1.K3), then as they are like older configurations bind them. The
+// key then falls through the active layers down to the base one. On each
+// layer the device bindings take precedence over the shared ones.
+func (o *Orchestrator) lookup(device string, name string) Action {
+	_, a := o.resolve(device, name)
+	return a
+}
+
+// resolve is lookup, also returning the name the action is registered with
+func (o *Orchestrator) resolve(device string, name string) (string, Action) {
+	key, g := SplitGestureKey(name)
+	layers := o.layers.Active()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var candidates []string
+	if caps, ok := o.caps[device]; ok && !IsChord(key) {
+		if layer, index, err := ParseKey(caps, key); err == nil && layer > 0 {
+			physical := fmt.Sprintf("K%d", index)
+			candidates = append(candidates, LayerKey(strconv.Itoa(layer), physical), key)
+			key = physical
+		}
 	}
-	log.Printf("Got: %s\n", line)
-	a := o.actions[line[0:len(line)-1]]
+	for _, l := range layers {
+		candidates = append(candidates, LayerKey(l, key))
+	}
+	candidates = append(candidates, key)
+	for _, c := range candidates {
+		c = GestureKey(c, g)
+		if a, ok := o.actions[DeviceKey(device, c)]; ok {
+			return DeviceKey(device, c), a
+		}
+		if a, ok := o.actions[c]; ok {
+			return c, a
+		}
+	}
+	return "", nil
+}
+
+// refresh shows on the keys of every pad the state of the action they are
+// bound to now, after a layer or a profile switch
+func (o *Orchestrator) refresh() {
+	for _, d := range o.Devices() {
+		o.mu.Lock()
+		l := o.links[d]
+		caps := o.caps[d]
+		o.mu.Unlock()
+		if l == nil {
+			continue
+		}
+		for i := 0; i < caps.Keys; i++ {
+			key := fmt.Sprintf("K%d", i)
+			name, a := o.resolve(d, key)
+			if a == nil {
+				continue
+			}
+			o.mu.Lock()
+			state, ok := o.states[name]
+			o.mu.Unlock()
+			if !ok {
+				state = -1
+			}
+			o.write(l, stateMessage(key, state))
+		}
+	}
+}
+
+// dispatch a gesture on key, held telling whether the key is still down.
+// Layer switches happen right away so that the next keys see them, other
+// actions run in their own goroutine according to the policy of their binding,
+// repeating until the release of the key when they are set to.
+func (o *Orchestrator) dispatch(device, key string, g Gesture, held bool) {
+	log.Printf("Got: %s %s from %s\n", g, key, device)
+	id := DeviceKey(device, key)
+	if g == Release {
+		o.mu.Lock()
+		hs := o.held[id]
+		delete(o.held, id)
+		o.mu.Unlock()
+		for _, h := range hs {
+			h.Release()
+		}
+	}
+	name, a := o.resolve(device, GestureKey(key, g))
 	if a == nil {
 		return
 	}
-	err := a.Execute()
-	if err != nil {
-		log.Println(err)
+	if h, ok := a.(holdAction); ok {
+		if g != Release && held {
+			o.hold(id, h)
+		}
+		o.executeAction(name, a)
+		if g != Release && !held {
+			// the key is already up, nothing would release it later
+			h.Release()
+		}
+		return
+	}
+	if g != Hold {
+		// a hold is followed by the gesture of the key, which still has to
+		// see the one-shot layers
+		o.layers.consumeOneShot()
+	}
+	busy := o.busyLock(name)
+	o.mu.Lock()
+	r, repeat := o.repeats[name]
+	o.mu.Unlock()
+	if repeat && held {
+		rp := newRepeater(a, r, busy)
+		o.hold(id, rp)
+		go rp.run(func(a Action) {
+			o.executeAction(name, a)
+		})
+		return
 	}
+	o.execute(name, a)
+}
+
+func (o *Orchestrator) hold(id string, h holdAction) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.held[id] = append(o.held[id], h)
+}
+
+// SetRepeat makes the action registered as name run again while its key is
+// held, the zero Repeat turns repeating off
+func (o *Orchestrator) SetRepeat(name string, r Repeat) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if r.Interval <= 0 {
+		delete(o.repeats, name)
+		return
+	}
+	o.repeats[name] = r
+}
+
+func stateMessage(name string, state int8) *protocol.Message {
+	m := &protocol.Message{Type: protocol.LED, Key: name}
+	if state == 1 {
+		m.Value = 1
+	}
+	return m
+}
+
+func progressMessage(name string, progress byte) *protocol.Message {
+	return &protocol.Message{Type: protocol.Progress, Key: name, Value: int(progress)}
+}
+
+// RunAction runs the action registered as name until it returns or ctx is
+// done, for the actions running others. The run follows the policy of the
+// binding, the actions already running in ctx are refused.
+func (o *Orchestrator) RunAction(ctx context.Context, name string) error {
+	chain := runChain(ctx)
+	for _, n := range chain {
+		if n == name {
+			return fmt.Errorf("%s cannot run itself through %s", name, strings.Join(chain, " > "))
+		}
+	}
+	a := o.action(name)
+	if a == nil {
+		return fmt.Errorf("no action registered as %s", name)
+	}
+	e := o.executor(name)
+	e.mu.Lock()
+	policy := e.policy
+	if policy == Drop && e.running+e.called > 0 {
+		e.dropped++
+		e.mu.Unlock()
+		return fmt.Errorf("dropped %s, it is still running", name)
+	}
+	e.called++
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.called--
+		e.mu.Unlock()
+	}()
+	if policy == Restart {
+		o.cancelRuns(name)
+	}
+	if policy != Parallel {
+		busy := o.busyLock(name)
+		busy.Lock()
+		defer busy.Unlock()
+	}
+	return o.executeContext(ctx, name, a)
+}
+
+// State of the LED of the action registered as name, 0 when it never set one
+func (o *Orchestrator) State(name string) int8 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.states[name]
 }
 
 func (o *Orchestrator) updateState(msg ActionMessage) {
 	if msg.State == 0 {
 		return
 	}
-	if msg.State == 1 {
-		o.serialOut.Write([]byte(fmt.Sprintf("%s1\n", msg.ActionName)))
-	} else {
-		o.serialOut.Write([]byte(fmt.Sprintf("%s0\n", msg.ActionName)))
-	}
-	log.Printf("Sent: %s%d\n", msg.ActionName, msg.State)
+	o.mu.Lock()
+	o.states[msg.ActionName] = msg.State
+	o.mu.Unlock()
+	o.send(msg.ActionName, func(key string) *protocol.Message {
+		return stateMessage(key, msg.State)
+	})
+	log.Printf("Sent: %s\n", stateMessage(msg.ActionName, msg.State))
 }
 
 func (o *Orchestrator) updateProgress(msg ActionMessage) {
-	o.serialOut.Write([]byte(fmt.Sprintf("%s-%d\n", strings.Replace(msg.ActionName, "K", "P", 1), msg.Progress)))
-	log.Printf(fmt.Sprintf("%s-%d\n", strings.Replace(msg.ActionName, "K", "P", 1), msg.Progress))
+	o.mu.Lock()
+	if msg.Progress == 0 {
+		delete(o.progress, msg.ActionName)
+	} else {
+		o.progress[msg.ActionName] = msg.Progress
+	}
+	o.mu.Unlock()
+	o.send(msg.ActionName, func(key string) *protocol.Message {
+		return progressMessage(key, msg.Progress)
+	})
+	log.Printf("Sent: %s\n", progressMessage(msg.ActionName, msg.Progress))
 }
@@ -1,8 +1,9 @@
 package pad
 
 import (
-	"bytes"
 	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 )
@@ -30,31 +31,36 @@ func newRw(in io.Reader, out io.Writer) *rw {
 }
 
 type dummyAction struct {
-	out chan<- ActionMessage
+	out  chan<- ActionMessage
+	done chan bool
 }
 
 func (a *dummyAction) Execute() error {
 
-	a.out <- ActionMessage{ActionName: "K1", Notify: "", State: false, Progress: 0}
+	a.out <- ActionMessage{ActionName: "K1", Notify: "", State: 1, Progress: 0}
+	a.done <- true
 
 	return nil
 }
 
+func (a *dummyAction) Stop() {
+}
+
 func TestRun(t *testing.T) {
-	in := new(bytes.Buffer)
-	out := new(bytes.Buffer)
-	s := newRw(in, out)
+	in := strings.NewReader("K10\nK11\n")
+	s := newRw(in, ioutil.Discard)
 
-	orch := NewOchestrator(s)
+	orch := NewOchestrator(nil)
+	done := make(chan bool, 1)
+	orch.RegisterAction("K1", &dummyAction{out: orch.Com, done: done})
+	orch.Attach(s)
 
 	go orch.Run()
 
-	in.WriteString("K1")
-	time.Sleep(10 * time.Millisecond)
-
-	line, err := out.ReadString('\n')
-	if err != nil || line != "Got: K1\n" {
-		t.Errorf("Expected 'Got: K1', got: '%s' (%v)", line, err)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected K1 to execute its action")
 	}
 
 	orch.Shutdown()
@@ -0,0 +1,164 @@
+package pad
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Policy tells what a press does while the action of its binding still runs
+type Policy string
+
+const (
+	// Parallel runs the action again alongside the running one
+	Parallel Policy = "parallel"
+	// Queue runs the action again once the running one is done
+	Queue Policy = "queue"
+	// Drop ignores the press
+	Drop Policy = "drop"
+	// Restart cancels the running action and runs it again once it returned.
+	// The presses coming meanwhile make a single run.
+	Restart Policy = "restart"
+)
+
+// ExecutionStats of a binding, reported in the status
+type ExecutionStats struct {
+	Running   int `json:"running"`
+	Queued    int `json:"queued"`
+	Dropped   int `json:"dropped"`
+	TimedOut  int `json:"timed_out"`
+	Cancelled int `json:"cancelled"`
+	Failed    int `json:"failed"`
+}
+
+// executor runs the action of a binding according to its policy. The runs of
+// the policies other than Parallel are serialized with the repeats and the
+// encoder steps of the binding through busy.
+type executor struct {
+	mu        sync.Mutex
+	policy    Policy
+	running   int
+	queued    int
+	dropped   int
+	timedOut  int
+	cancelled int
+	failed    int
+	// called are the runs of RunAction
+	called int
+}
+
+// SetPolicy of the binding name, Parallel when empty
+func (o *Orchestrator) SetPolicy(name string, p Policy) error {
+	switch p {
+	case "":
+		p = Parallel
+	case Parallel, Queue, Drop, Restart:
+	default:
+		return fmt.Errorf("unknown policy %s", p)
+	}
+	e := o.executor(name)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policy = p
+	return nil
+}
+
+func (o *Orchestrator) executor(name string) *executor {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e := o.executors[name]
+	if e == nil {
+		e = &executor{policy: Parallel}
+		o.executors[name] = e
+	}
+	return e
+}
+
+// Executions returns the stats of the bindings which are running, have queued
+// runs, dropped presses or runs which did not succeed
+func (o *Orchestrator) Executions() map[string]ExecutionStats {
+	o.mu.Lock()
+	executors := make(map[string]*executor, len(o.executors))
+	for name, e := range o.executors {
+		executors[name] = e
+	}
+	o.mu.Unlock()
+	stats := make(map[string]ExecutionStats)
+	for name, e := range executors {
+		e.mu.Lock()
+		s := ExecutionStats{Running: e.running + e.called, Queued: e.queued, Dropped: e.dropped,
+			TimedOut: e.timedOut, Cancelled: e.cancelled, Failed: e.failed}
+		e.mu.Unlock()
+		if s != (ExecutionStats{}) {
+			stats[name] = s
+		}
+	}
+	return stats
+}
+
+// execute the action a bound as name according to the policy of the binding
+func (o *Orchestrator) execute(name string, a Action) {
+	e := o.executor(name)
+	busy := o.busyLock(name)
+	e.mu.Lock()
+	if e.policy == Parallel {
+		e.running++
+		e.mu.Unlock()
+		go func() {
+			o.executeAction(name, a)
+			e.mu.Lock()
+			e.running--
+			e.mu.Unlock()
+		}()
+		return
+	}
+	if e.running == 0 {
+		e.running = 1
+		e.mu.Unlock()
+		go e.work(a, busy, func(a Action) {
+			o.executeAction(name, a)
+		})
+		return
+	}
+	switch e.policy {
+	case Drop:
+		e.dropped++
+		e.mu.Unlock()
+		log.Printf("Dropped %s, it is still running\n", name)
+	case Queue:
+		e.queued++
+		queued := e.queued
+		e.mu.Unlock()
+		log.Printf("Queued %s, %d run(s) waiting\n", name, queued)
+	case Restart:
+		restart := e.queued == 0
+		if !restart {
+			e.dropped++
+		}
+		e.queued = 1
+		e.mu.Unlock()
+		if restart {
+			log.Printf("Restarting %s\n", name)
+			o.cancelRuns(name)
+		} else {
+			log.Printf("Dropped %s, it is already restarting\n", name)
+		}
+	}
+}
+
+// work runs the action, then the queued runs
+func (e *executor) work(a Action, busy *sync.Mutex, execute func(Action)) {
+	for {
+		busy.Lock()
+		execute(a)
+		busy.Unlock()
+		e.mu.Lock()
+		if e.queued == 0 {
+			e.running = 0
+			e.mu.Unlock()
+			return
+		}
+		e.queued--
+		e.mu.Unlock()
+	}
+}
@@ -0,0 +1,50 @@
+package pad
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicies(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		runs     int
+		overlaps bool
+		stats    ExecutionStats
+	}{
+		{Parallel, 3, true, ExecutionStats{Running: 3}},
+		{Queue, 3, false, ExecutionStats{Running: 1, Queued: 2}},
+		{Drop, 1, false, ExecutionStats{Running: 1, Dropped: 2}},
+		{Restart, 2, false, ExecutionStats{Running: 1, Queued: 1, Dropped: 1}},
+	}
+	for _, test := range tests {
+		orch := NewOchestrator(nil)
+		a := &slowAction{}
+		if err := orch.SetPolicy("K0", test.policy); err != nil {
+			t.Fatal(err)
+		}
+		// Hold the binding so that the presses find it running
+		busy := orch.busyLock("K0")
+		busy.Lock()
+		for i := 0; i < 3; i++ {
+			orch.execute("K0", a)
+		}
+		if test.policy != Parallel {
+			if stats := orch.Executions()["K0"]; stats != test.stats {
+				t.Errorf("%s: expected %+v, got %+v", test.policy, test.stats, stats)
+			}
+		}
+		busy.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		runs, overlaps := a.counts()
+		if runs != test.runs || (overlaps > 0) != test.overlaps {
+			t.Errorf("%s: expected %d runs, got %d with %d overlaps", test.policy, test.runs, runs, overlaps)
+		}
+		if stats := orch.Executions()["K0"]; stats.Running != 0 || stats.Queued != 0 {
+			t.Errorf("%s: expected the runs to be done, got %+v", test.policy, stats)
+		}
+	}
+	if err := NewOchestrator(nil).SetPolicy("K0", "twice"); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
@@ -0,0 +1,83 @@
+package pad
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/hlidotbe/macropad/focus"
+)
+
+// Profile binds keys while the focused window matches its rules. Its keys are
+// bound on the layer named after it, which sits right above the base layer.
+type Profile struct {
+	Name  string
+	Class *regexp.Regexp
+	Title *regexp.Regexp
+}
+
+// NewProfile compiles the rules of a profile, empty rules match any window
+func NewProfile(name string, class string, title string) (Profile, error) {
+	p := Profile{Name: name}
+	if len(name) == 0 || name == BaseLayer || strings.ContainsAny(name, ".:/+ ") {
+		return p, fmt.Errorf("invalid profile name %q", name)
+	}
+	var err error
+	if len(class) > 0 {
+		if p.Class, err = regexp.Compile(class); err != nil {
+			return p, fmt.Errorf("profile %s: %v", name, err)
+		}
+	}
+	if len(title) > 0 {
+		if p.Title, err = regexp.Compile(title); err != nil {
+			return p, fmt.Errorf("profile %s: %v", name, err)
+		}
+	}
+	return p, nil
+}
+
+// Matches returns true if the window matches every rule of the profile
+func (p Profile) Matches(w focus.Window) bool {
+	if p.Class != nil && !p.Class.MatchString(w.Class) {
+		return false
+	}
+	if p.Title != nil && !p.Title.MatchString(w.Title) {
+		return false
+	}
+	return true
+}
+
+// SetProfiles replaces the profiles, the first one matching the focused
+// window is active
+func (o *Orchestrator) SetProfiles(profiles []Profile) {
+	o.mu.Lock()
+	o.profiles = profiles
+	w := o.focused
+	o.mu.Unlock()
+	o.Focus(w)
+}
+
+// Focus switches to the profile of the focused window, the LEDs then show the
+// state of the actions bound by the profile
+func (o *Orchestrator) Focus(w focus.Window) {
+	o.mu.Lock()
+	o.focused = w
+	var name string
+	for _, p := range o.profiles {
+		if p.Matches(w) {
+			name = p.Name
+			break
+		}
+	}
+	o.mu.Unlock()
+	if name != o.layers.Profile() {
+		log.Printf("Profile %q for %v\n", name, w)
+		o.layers.SetProfile(name)
+	}
+}
+
+// Profile returns the name of the active profile, empty when none is
+func (o *Orchestrator) Profile() string {
+	return o.layers.Profile()
+}
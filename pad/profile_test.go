@@ -0,0 +1,56 @@
+package pad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hlidotbe/macropad/focus"
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+func TestProfileMatches(t *testing.T) {
+	p, err := NewProfile("ide", "^jetbrains-", "\\.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Matches(focus.Window{Class: "jetbrains-goland", Title: "main.go"}) {
+		t.Error("Expected the profile to match")
+	}
+	if p.Matches(focus.Window{Class: "jetbrains-goland", Title: "README.md"}) || p.Matches(focus.Window{Class: "kitty", Title: "vim main.go"}) {
+		t.Error("Expected every rule to match")
+	}
+	if _, err = NewProfile("ide", "(", ""); err == nil {
+		t.Error("Expected invalid rules to be rejected")
+	}
+}
+
+func TestProfileSwitch(t *testing.T) {
+	orch := NewOchestrator(nil)
+	orch.RegisterAction("K0", &ledAction{name: "K0", out: orch.Com})
+	orch.RegisterAction(LayerKey("ide", "K0"), &ledAction{name: LayerKey("ide", "K0"), out: orch.Com})
+	ide, _ := NewProfile("ide", "jetbrains", "")
+	browser, _ := NewProfile("browser", "firefox", "")
+	orch.SetProfiles([]Profile{ide, browser})
+	go orch.Run()
+	defer orch.Shutdown()
+
+	port := newTestPort()
+	orch.AttachDevice(DefaultDevice, protocol.NewLegacyCodec(port))
+	orch.Focus(focus.Window{Class: "jetbrains-goland"})
+	time.Sleep(10 * time.Millisecond)
+	if orch.Profile() != "ide" {
+		t.Errorf("Expected the ide profile, got %q", orch.Profile())
+	}
+	port.pad.Write([]byte("K00\n"))
+	time.Sleep(10 * time.Millisecond)
+	if port.written() != "K00\nK01\n" {
+		t.Errorf("Expected the ide K0 to light, got '%s'", port.written())
+	}
+
+	// The base K0 has no state of its own
+	orch.Focus(focus.Window{Class: "kitty"})
+	time.Sleep(10 * time.Millisecond)
+	if orch.Profile() != "" || port.written() != "K00\nK01\nK00\n" {
+		t.Errorf("Expected no profile and K0 to turn off, got %q and '%s'", orch.Profile(), port.written())
+	}
+}
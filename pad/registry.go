@@ -0,0 +1,424 @@
+package pad
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hlidotbe/macropad/auxilium"
+)
+
+// FieldKind is the type of the value of a Field
+type FieldKind string
+
+const (
+	// FieldString is a string
+	FieldString FieldKind = "string"
+	// FieldStrings is a list of strings, e.g. the arguments of a command
+	FieldStrings FieldKind = "strings"
+	// FieldInt is an integer
+	FieldInt FieldKind = "int"
+	// FieldBool is a boolean
+	FieldBool FieldKind = "bool"
+	// FieldDuration is a duration, numbers are counted in the Unit of the field
+	// and strings parsed as time.ParseDuration does
+	FieldDuration FieldKind = "duration"
+	// FieldMap is a set of strings by name, e.g. the headers of a request
+	FieldMap FieldKind = "map"
+	// FieldChoice is one of the Choices of the field
+	FieldChoice FieldKind = "choice"
+	// FieldActions is a list of nested actions, each with its type and fields
+	FieldActions FieldKind = "actions"
+	// FieldAction is a nested action with its type and fields
+	FieldAction FieldKind = "action"
+	// FieldCondition is the Condition of a conditional action
+	FieldCondition FieldKind = "condition"
+)
+
+// Field of the configuration of an action type
+type Field struct {
+	// Name of the field in the configuration of a key
+	Name     string    `json:"name"`
+	Kind     FieldKind `json:"kind"`
+	Label    string    `json:"label"`
+	Required bool      `json:"required,omitempty"`
+	// Choices of a FieldChoice, the first one being the default
+	Choices []string `json:"choices,omitempty"`
+	// Unit of the numbers given to a FieldDuration
+	Unit time.Duration `json:"-"`
+}
+
+// Env is what the actions of the pads share
+type Env struct {
+	Out      chan<- ActionMessage
+	Layers   *Layers
+	Auxilium *auxilium.Client
+	// State of the LED of a binding, 1 when on
+	State func(name string) int8
+	// Injector of the keystrokes of Type actions, cliclick when nil
+	Injector Injector
+	// Run the action registered as name, for the actions running others
+	Run func(ctx context.Context, name string) error
+	// Store keeps the state of the actions across restarts, in memory when
+	// nil
+	Store *Store
+	// Scripts is the directory of the scripts of Script actions
+	Scripts string
+}
+
+// Factory creates an action bound as name from its validated params
+type Factory func(name string, env Env, p Params) (Action, error)
+
+// ActionKind describes a kind of action and how to create it
+type ActionKind struct {
+	// Name of the type in the configuration, matched regardless of case
+	Name   string  `json:"name"`
+	Label  string  `json:"label"`
+	Fields []Field `json:"fields"`
+	// Policy of the bindings of the type which do not set one
+	Policy Policy  `json:"policy,omitempty"`
+	New    Factory `json:"-"`
+	// Check the decoded params beyond their kinds, if needed
+	Check func(p Params) error `json:"-"`
+}
+
+var registry = struct {
+	sync.Mutex
+	types map[string]ActionKind
+}{types: make(map[string]ActionKind)}
+
+// RegisterActionKind makes the kind available by its name, replacing any type
+// registered with the same name
+func RegisterActionKind(t ActionKind) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.types[strings.ToLower(t.Name)] = t
+}
+
+// ActionKinds returns the registered kinds sorted by name
+func ActionKinds() []ActionKind {
+	registry.Lock()
+	defer registry.Unlock()
+	var types []ActionKind
+	for _, t := range registry.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// LookupActionKind returns the type registered as kind
+func LookupActionKind(kind string) (ActionKind, error) {
+	registry.Lock()
+	defer registry.Unlock()
+	t, ok := registry.types[strings.ToLower(kind)]
+	if !ok {
+		return t, fmt.Errorf("unknown action type %q", kind)
+	}
+	return t, nil
+}
+
+// CreateAction creates an action of type kind bound as name, from params
+// decoded from its configuration
+func CreateAction(kind string, name string, env Env, params Params) (Action, error) {
+	t, err := LookupActionKind(kind)
+	if err != nil {
+		return nil, err
+	}
+	p, err := t.decode(params)
+	if err != nil {
+		return nil, fmt.Errorf("%s action: %v", t.Name, err)
+	}
+	return t.New(name, env, p)
+}
+
+// CheckAction returns the error creating an action of type kind from params
+// would return, without creating it
+func CheckAction(kind string, params Params) error {
+	t, err := LookupActionKind(kind)
+	if err != nil {
+		return err
+	}
+	if _, err = t.decode(params); err != nil {
+		return fmt.Errorf("%s action: %v", t.Name, err)
+	}
+	return nil
+}
+
+// NewAction creates an action of type kind bound as name, args being the
+// values of the fields of the type in order. A list of strings takes the
+// remaining args. It returns nil, logging why, when the action cannot be
+// created.
+func NewAction(kind string, name string, out chan<- ActionMessage, args ...interface{}) Action {
+	t, err := LookupActionKind(kind)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	p := make(Params)
+	for i, f := range t.Fields {
+		if i >= len(args) {
+			break
+		}
+		if f.Kind == FieldStrings {
+			var rest []string
+			for _, a := range args[i:] {
+				rest = append(rest, fmt.Sprint(a))
+			}
+			p[f.Name] = rest
+			break
+		}
+		p[f.Name] = args[i]
+	}
+	a, err := CreateAction(kind, name, Env{Out: out}, p)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return a
+}
+
+// Params of an action, by field name
+type Params map[string]interface{}
+
+// String returns the value of a FieldString or FieldChoice
+func (p Params) String(name string) string {
+	s, _ := p[name].(string)
+	return s
+}
+
+// Strings returns the value of a FieldStrings
+func (p Params) Strings(name string) []string {
+	s, _ := p[name].([]string)
+	return s
+}
+
+// Int returns the value of a FieldInt
+func (p Params) Int(name string) int {
+	n, _ := p[name].(int)
+	return n
+}
+
+// Bool returns the value of a FieldBool
+func (p Params) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+// Map returns the value of a FieldMap
+func (p Params) Map(name string) map[string]string {
+	m, _ := p[name].(map[string]string)
+	return m
+}
+
+// Duration returns the value of a FieldDuration
+func (p Params) Duration(name string) time.Duration {
+	d, _ := p[name].(time.Duration)
+	return d
+}
+
+// ActionConfig is the configuration of a nested action
+type ActionConfig struct {
+	Type   string
+	Params Params
+}
+
+// Actions returns the value of a FieldActions
+func (p Params) Actions(name string) []ActionConfig {
+	a, _ := p[name].([]ActionConfig)
+	return a
+}
+
+// Action returns the value of a FieldAction, nil when missing
+func (p Params) Action(name string) *ActionConfig {
+	a, _ := p[name].(ActionConfig)
+	if len(a.Type) == 0 {
+		return nil
+	}
+	return &a
+}
+
+// Condition returns the value of a FieldCondition
+func (p Params) Condition(name string) Condition {
+	c, _ := p[name].(Condition)
+	return c
+}
+
+// decode checks params against the fields of the type, returning them
+// converted to the Go type of their kind. Params which are not fields are
+// left out.
+func (t ActionKind) decode(params Params) (Params, error) {
+	p := make(Params)
+	for _, f := range t.Fields {
+		v, ok := params[f.Name]
+		if !ok || v == nil {
+			if f.Required {
+				return nil, fmt.Errorf("%s is required", f.Name)
+			}
+			continue
+		}
+		d, err := f.decode(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if f.Required && isZero(d) {
+			return nil, fmt.Errorf("%s is required", f.Name)
+		}
+		p[f.Name] = d
+	}
+	if t.Check != nil {
+		if err := t.Check(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (f Field) decode(v interface{}) (interface{}, error) {
+	switch f.Kind {
+	case FieldString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case FieldChoice:
+		s, ok := v.(string)
+		if !ok {
+			break
+		}
+		if len(s) == 0 && len(f.Choices) > 0 {
+			return f.Choices[0], nil
+		}
+		for _, c := range f.Choices {
+			if c == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("expected one of %s, got %q", strings.Join(f.Choices, ", "), s)
+	case FieldStrings:
+		switch v := v.(type) {
+		case []string:
+			return v, nil
+		case string:
+			return []string{v}, nil
+		case []interface{}:
+			var s []string
+			for _, e := range v {
+				str, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected strings, got %v", e)
+				}
+				s = append(s, str)
+			}
+			return s, nil
+		}
+	case FieldMap:
+		switch v := v.(type) {
+		case map[string]string:
+			return v, nil
+		case map[string]interface{}:
+			m := make(map[string]string)
+			for k, e := range v {
+				str, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: expected a string, got %v", k, e)
+				}
+				m[k] = str
+			}
+			return m, nil
+		}
+	case FieldInt:
+		switch v := v.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == float64(int(v)) {
+				return int(v), nil
+			}
+		}
+	case FieldBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case FieldActions:
+		return decodeActions(v)
+	case FieldAction:
+		return decodeAction(v)
+	case FieldCondition:
+		return decodeCondition(v)
+	case FieldDuration:
+		unit := f.Unit
+		if unit == 0 {
+			unit = time.Second
+		}
+		switch v := v.(type) {
+		case time.Duration:
+			return v, nil
+		case int:
+			return time.Duration(v) * unit, nil
+		case float64:
+			return time.Duration(v * float64(unit)), nil
+		case string:
+			return time.ParseDuration(v)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %s", f.Kind)
+	}
+	return nil, fmt.Errorf("expected a %s, got %v", f.Kind, v)
+}
+
+// decodeActions checks nested actions, given as ActionConfigs or as maps
+// holding their type and fields
+func decodeActions(v interface{}) (interface{}, error) {
+	if actions, ok := v.([]ActionConfig); ok {
+		for i, a := range actions {
+			if _, err := decodeAction(a); err != nil {
+				return nil, fmt.Errorf("action %d: %v", i, err)
+			}
+		}
+		return actions, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected actions, got %v", v)
+	}
+	var actions []ActionConfig
+	for i, e := range list {
+		a, err := decodeAction(e)
+		if err != nil {
+			return nil, fmt.Errorf("action %d: %v", i, err)
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// decodeAction checks a nested action, given as an ActionConfig or as a map
+// holding its type and fields
+func decodeAction(v interface{}) (ActionConfig, error) {
+	a, ok := v.(ActionConfig)
+	if !ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return a, fmt.Errorf("expected a type and fields, got %v", v)
+		}
+		kind, _ := m["type"].(string)
+		a = ActionConfig{Type: kind, Params: Params(m)}
+	}
+	return a, CheckAction(a.Type, a.Params)
+}
+
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	case []ActionConfig:
+		return len(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package pad
+
+import (
+	"testing"
+	"time"
+)
+
+type echoAction struct {
+	text string
+}
+
+func (a *echoAction) Execute() error {
+	return nil
+}
+
+func (a *echoAction) Stop() {
+}
+
+func TestRegisterActionKind(t *testing.T) {
+	RegisterActionKind(ActionKind{
+		Name:   "Echo",
+		Fields: []Field{{Name: "text", Kind: FieldString, Required: true}},
+		New: func(name string, env Env, p Params) (Action, error) {
+			return &echoAction{text: p.String("text")}, nil
+		},
+	})
+	a, err := CreateAction("echo", "K0", Env{}, Params{"text": "hello"})
+	if err != nil || a.(*echoAction).text != "hello" {
+		t.Errorf("Expected an echo of hello, got %v (%v)", a, err)
+	}
+	found := false
+	for _, k := range ActionKinds() {
+		found = found || k.Name == "Echo"
+	}
+	if !found {
+		t.Error("Expected Echo to be listed")
+	}
+}
+
+func TestCreateAction(t *testing.T) {
+	// Values as decoded from JSON
+	a, err := CreateAction("Pomodoro", "K0", Env{}, Params{"duration": float64(25)})
+	if err != nil || a.(*actionPomodoro).duration != 25*time.Minute {
+		t.Errorf("Expected a pomodoro of 25 minutes, got %v (%v)", a, err)
+	}
+	a, err = CreateAction("Macro", "K0", Env{}, Params{"args": []interface{}{"say", "hi"}, "display_output": true})
+	if m, ok := a.(*actionMacro); err != nil || !ok || len(m.args) != 2 || !m.displayOutput {
+		t.Errorf("Expected a macro saying hi, got %v (%v)", a, err)
+	}
+	if _, err = CreateAction("Layer", "K0", Env{Layers: newLayers()}, Params{"layer": "media", "mode": "sideways"}); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+	bad := []struct {
+		kind   string
+		params Params
+	}{
+		{"Unknown", Params{}},
+		{"Macro", Params{}},
+		{"Macro", Params{"args": []interface{}{}}},
+		{"Track", Params{"id": "twelve"}},
+		{"Layer", Params{"layer": "media"}},
+	}
+	for _, b := range bad {
+		if _, err = CreateAction(b.kind, "K0", Env{}, b.params); err == nil {
+			t.Errorf("Expected %s %v to be rejected", b.kind, b.params)
+		}
+	}
+	if CheckAction("Macro", Params{}) == nil || CheckAction("Type", Params{"args": "t:hi"}) != nil {
+		t.Error("Unexpected result of CheckAction")
+	}
+}
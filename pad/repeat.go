@@ -0,0 +1,84 @@
+package pad
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Repeat settings of a binding, whose action runs again and again while its
+// key is held
+type Repeat struct {
+	// Delay before the first repeat, Interval when zero
+	Delay time.Duration
+	// Interval between the starts of two repeats, no repeat when zero
+	Interval time.Duration
+	// Max repeats, unlimited when zero
+	Max int
+}
+
+// repeater runs an action until its key is released. The runs happen one
+// after the other, never overlapping, and are serialized with the other
+// repeaters of the same binding through busy.
+type repeater struct {
+	action  Action
+	repeat  Repeat
+	busy    *sync.Mutex
+	stop    chan bool
+	release sync.Once
+}
+
+func newRepeater(a Action, r Repeat, busy *sync.Mutex) *repeater {
+	return &repeater{action: a, repeat: r, busy: busy, stop: make(chan bool)}
+}
+
+func (r *repeater) Execute() error {
+	return r.ExecuteContext(context.Background())
+}
+
+func (r *repeater) ExecuteContext(ctx context.Context) error {
+	r.busy.Lock()
+	defer r.busy.Unlock()
+	return Execute(ctx, r.action)
+}
+
+func (r *repeater) Stop() {
+	r.Release()
+}
+
+// Release stops the repeats, the one running finishes
+func (r *repeater) Release() {
+	r.release.Do(func() {
+		close(r.stop)
+	})
+}
+
+// run executes the action, then repeats it until Release
+func (r *repeater) run(execute func(Action)) {
+	execute(r)
+	wait := r.repeat.Delay
+	if wait <= 0 {
+		wait = r.repeat.Interval
+	}
+	for n := 0; r.repeat.Max <= 0 || n < r.repeat.Max; n++ {
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(wait):
+		}
+		// Both may be ready after a slow run
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		started := time.Now()
+		execute(r)
+		// The interval counts from the start of the run, a slow run is
+		// followed right away by the next one
+		wait = r.repeat.Interval - time.Since(started)
+		if wait < 0 {
+			wait = 0
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pad
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowAction counts its runs and whether two of them overlapped
+type slowAction struct {
+	mu       sync.Mutex
+	running  bool
+	runs     int
+	overlaps int
+}
+
+func (a *slowAction) Execute() error {
+	a.mu.Lock()
+	if a.running {
+		a.overlaps++
+	}
+	a.running = true
+	a.runs++
+	a.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	a.mu.Lock()
+	a.running = false
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *slowAction) Stop() {
+}
+
+func (a *slowAction) counts() (int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.runs, a.overlaps
+}
+
+func TestRepeat(t *testing.T) {
+	orch := NewOchestrator(nil)
+	a := new(slowAction)
+	orch.RegisterAction("K0", a)
+	orch.SetRepeat("K0", Repeat{Delay: 20 * time.Millisecond, Interval: time.Millisecond})
+
+	orch.dispatch(DefaultDevice, "K0", Tap, true)
+	time.Sleep(10 * time.Millisecond)
+	if runs, _ := a.counts(); runs != 1 {
+		t.Errorf("Expected a single run before the delay, got %d", runs)
+	}
+	time.Sleep(40 * time.Millisecond)
+	orch.dispatch(DefaultDevice, "K0", Release, false)
+	time.Sleep(10 * time.Millisecond)
+	runs, overlaps := a.counts()
+	if runs < 3 || overlaps != 0 {
+		t.Errorf("Expected several runs without overlap, got %d runs and %d overlaps", runs, overlaps)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if after, _ := a.counts(); after != runs {
+		t.Errorf("Expected the repeats to stop on release, got %d more runs", after-runs)
+	}
+}
+
+func TestRepeatMax(t *testing.T) {
+	orch := NewOchestrator(nil)
+	a := new(slowAction)
+	orch.RegisterAction("K0", a)
+	orch.SetRepeat("K0", Repeat{Interval: time.Millisecond, Max: 2})
+
+	orch.dispatch(DefaultDevice, "K0", Tap, true)
+	time.Sleep(50 * time.Millisecond)
+	if runs, _ := a.counts(); runs != 3 {
+		t.Errorf("Expected the run and 2 repeats, got %d runs", runs)
+	}
+
+	// Taps once the key is up do not repeat
+	orch.dispatch(DefaultDevice, "K0", Tap, false)
+	time.Sleep(30 * time.Millisecond)
+	if runs, _ := a.counts(); runs != 4 {
+		t.Errorf("Expected a single run, got %d runs", runs-3)
+	}
+}
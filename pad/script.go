@@ -0,0 +1,327 @@
+package pad
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// ActionScript runs a Starlark script
+const ActionScript = "script"
+
+func init() {
+	RegisterActionKind(ActionKind{
+		Name:   ActionScript,
+		Label:  "Script",
+		Fields: []Field{{Name: "script", Kind: FieldString, Label: "Script", Required: true}},
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionScript(name, env, p.String("script"))
+		},
+	})
+}
+
+// scriptOptions allow scripts to loop and branch at the top level
+var scriptOptions = &syntax.FileOptions{While: true, TopLevelControl: true, GlobalReassign: true, Recursion: true}
+
+// scriptGlobals are the names the host predeclares for the scripts
+var scriptGlobals = []string{"key", "delta", "value", "json", "notify", "set_state", "set_progress",
+	"run", "http", "kv_get", "kv_set", "sleep"}
+
+// NewActionScript configure and returns an action running the Starlark script
+// at path, relative to env.Scripts. The script runs from the top at every
+// press and is loaded again whenever the file changes. Its host API is:
+//
+//	key                  the name of the binding
+//	delta, value         the steps of an encoder or the value of a slider
+//	notify(text)         sends a notification
+//	set_state(on)        lights the key or turns it off
+//	set_progress(p)      shows a progress from 1 to 255, 0 being off
+//	run(key)             runs the action bound as key and waits for it
+//	http(url, method="GET", body="", headers={})
+//	                     returns the status and the body of the response
+//	kv_get(k, default)   reads a value kept across restarts
+//	kv_set(k, v)         keeps a value across restarts
+//	sleep(seconds)       waits, unless the action is cancelled
+//	json                 encodes and decodes JSON
+func NewActionScript(name string, env Env, path string) (Action, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(env.Scripts, path)
+	}
+	a := &actionScript{name: name, out: env.Out, path: path, env: env, cancels: make(map[int]context.CancelFunc)}
+	if a.env.Store == nil {
+		a.env.Store, _ = OpenStore("")
+	}
+	if _, err := a.program(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type actionScript struct {
+	name string
+	out  chan<- ActionMessage
+	path string
+	env  Env
+
+	// mu guards the compiled program, reloaded when the file changes, and
+	// the cancels of the running scripts, cancelled by Stop
+	mu       sync.Mutex
+	prog     *starlark.Program
+	modified time.Time
+	cancels  map[int]context.CancelFunc
+	next     int
+}
+
+// program returns the script, compiled again when the file changed
+func (a *actionScript) program() (*starlark.Program, error) {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.prog != nil && info.ModTime().Equal(a.modified) {
+		return a.prog, nil
+	}
+	src, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return nil, err
+	}
+	isPredeclared := func(name string) bool {
+		for _, g := range scriptGlobals {
+			if g == name {
+				return true
+			}
+		}
+		return false
+	}
+	_, prog, err := starlark.SourceProgramOptions(scriptOptions, a.path, src, isPredeclared)
+	if err != nil {
+		return nil, err
+	}
+	if a.prog != nil {
+		log.Printf("Reloaded %s for %s\n", a.path, a.name)
+	}
+	a.prog, a.modified = prog, info.ModTime()
+	return prog, nil
+}
+
+func (a *actionScript) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *actionScript) ExecuteContext(ctx context.Context) error {
+	return a.run(ctx, 0, 0)
+}
+
+// Turn runs the script with the steps of the encoder as delta
+func (a *actionScript) Turn(ctx context.Context, delta int) error {
+	return a.run(ctx, delta, 0)
+}
+
+// SetValue runs the script with the analog value as value
+func (a *actionScript) SetValue(ctx context.Context, value int) error {
+	return a.run(ctx, 0, value)
+}
+
+func (a *actionScript) run(ctx context.Context, delta int, value int) error {
+	prog, err := a.program()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.next++
+	id := a.next
+	a.cancels[id] = cancel
+	a.mu.Unlock()
+	defer func() {
+		cancel()
+		a.mu.Lock()
+		delete(a.cancels, id)
+		a.mu.Unlock()
+	}()
+
+	thread := &starlark.Thread{
+		Name: a.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("%s: %s\n", a.name, msg)
+		},
+	}
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+	globals := a.globals(ctx)
+	globals["delta"] = starlark.MakeInt(delta)
+	globals["value"] = starlark.MakeInt(value)
+	_, err = prog.Init(thread, globals)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if e, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", e.Backtrace())
+	}
+	return err
+}
+
+// globals returns the host API of a run of the script ending with ctx
+func (a *actionScript) globals(ctx context.Context) starlark.StringDict {
+	return starlark.StringDict{
+		"key":  starlark.String(a.name),
+		"json": json.Module,
+		"notify": starlark.NewBuiltin("notify", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var text string
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &text); err != nil {
+				return nil, err
+			}
+			a.out <- ActionMessage{ActionName: a.name, Notify: text}
+			return starlark.None, nil
+		}),
+		"set_state": starlark.NewBuiltin("set_state", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var on bool
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &on); err != nil {
+				return nil, err
+			}
+			state := int8(-1)
+			if on {
+				state = 1
+			}
+			a.out <- ActionMessage{ActionName: a.name, State: state}
+			return starlark.None, nil
+		}),
+		"set_progress": starlark.NewBuiltin("set_progress", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var p int
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &p); err != nil {
+				return nil, err
+			}
+			if p < 0 || p > 255 {
+				return nil, fmt.Errorf("%s: %d is not between 0 and 255", b.Name(), p)
+			}
+			a.out <- ActionMessage{ActionName: a.name, Progress: byte(p)}
+			return starlark.None, nil
+		}),
+		"run": starlark.NewBuiltin("run", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &key); err != nil {
+				return nil, err
+			}
+			if a.env.Run == nil {
+				return nil, fmt.Errorf("%s: no actions to run", b.Name())
+			}
+			return starlark.None, a.env.Run(ctx, key)
+		}),
+		"http": starlark.NewBuiltin("http", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var url, body string
+			method := http.MethodGet
+			headers := new(starlark.Dict)
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &url, "method?", &method, "body?", &body, "headers?", &headers); err != nil {
+				return nil, err
+			}
+			return a.request(ctx, method, url, body, headers)
+		}),
+		"kv_get": starlark.NewBuiltin("kv_get", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var k string
+			var def starlark.Value = starlark.None
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "k", &k, "default?", &def); err != nil {
+				return nil, err
+			}
+			var encoded string
+			if ok, err := a.env.Store.Get(a.storeKey(k), &encoded); !ok || err != nil {
+				return def, err
+			}
+			return starlark.Call(thread, json.Module.Members["decode"], starlark.Tuple{starlark.String(encoded)}, nil)
+		}),
+		"kv_set": starlark.NewBuiltin("kv_set", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var k string
+			var v starlark.Value
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "k", &k, "v", &v); err != nil {
+				return nil, err
+			}
+			encoded, err := starlark.Call(thread, json.Module.Members["encode"], starlark.Tuple{v}, nil)
+			if err != nil {
+				return nil, err
+			}
+			return starlark.None, a.env.Store.Set(a.storeKey(k), string(encoded.(starlark.String)))
+		}),
+		"sleep": starlark.NewBuiltin("sleep", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var v starlark.Value
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &v); err != nil {
+				return nil, err
+			}
+			seconds, ok := starlark.AsFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("%s: got %s, want a number", b.Name(), v.Type())
+			}
+			return starlark.None, sleep(ctx, time.Duration(seconds*float64(time.Second)))
+		}),
+	}
+}
+
+// storeKey is the key of the store holding the value k of the script, each
+// binding keeps its own values
+func (a *actionScript) storeKey(k string) string {
+	return "script/" + a.name + "/" + k
+}
+
+// request sends an HTTP request for a script and returns a struct with the
+// status and the body of the response
+func (a *actionScript) request(ctx context.Context, method string, url string, body string, headers *starlark.Dict) (starlark.Value, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, httpTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range headers.Items() {
+		k, ok1 := starlark.AsString(item[0])
+		v, ok2 := starlark.AsString(item[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("http: headers must be strings")
+		}
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, err
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"status": starlark.MakeInt(resp.StatusCode),
+		"body":   starlark.String(b),
+	}), nil
+}
+
+// Stop cancels the running scripts
+func (a *actionScript) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, cancel := range a.cancels {
+		cancel()
+	}
+}
@@ -0,0 +1,184 @@
+package pad
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scriptDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeScript(t *testing.T, dir string, name string, src string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Tell the versions apart on file systems with a coarse modification time
+	later := time.Now().Add(time.Duration(len(src)) * time.Second)
+	os.Chtimes(path, later, later)
+}
+
+func TestScript(t *testing.T) {
+	dir := scriptDir(t)
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "` + r.Header.Get("X-Name") + `"}`))
+	}))
+	defer server.Close()
+
+	writeScript(t, dir, "hello.star", `
+count = kv_get("count", 0) + 1
+kv_set("count", count)
+r = http("`+server.URL+`", headers={"X-Name": key})
+set_state(True)
+set_progress(count)
+run("K2")
+notify("%s %d %d" % (json.decode(r.body)["name"], r.status, count))
+`)
+	store, _ := OpenStore("")
+	out := make(chan ActionMessage, 10)
+	var ran []string
+	env := Env{Out: out, Store: store, Scripts: dir, Run: func(ctx context.Context, name string) error {
+		ran = append(ran, name)
+		return nil
+	}}
+	a, err := CreateAction(ActionScript, "K1", env, Params{"script": "hello.star"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := a.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var notifications []string
+	state, progress := int8(0), byte(0)
+	for len(out) > 0 {
+		msg := <-out
+		if len(msg.Notify) > 0 {
+			notifications = append(notifications, msg.Notify)
+		}
+		if msg.State != 0 {
+			state = msg.State
+		}
+		if msg.Progress > progress {
+			progress = msg.Progress
+		}
+	}
+	if strings.Join(notifications, ",") != "K1 200 1,K1 200 2" {
+		t.Errorf("Unexpected notifications %v", notifications)
+	}
+	if state != 1 || progress != 2 {
+		t.Errorf("Expected the key to be lit with a progress of 2, got %d and %d", state, progress)
+	}
+	if strings.Join(ran, ",") != "K2,K2" {
+		t.Errorf("Expected K2 to run twice, got %v", ran)
+	}
+	var count string
+	if ok, _ := store.Get("script/K1/count", &count); !ok || count != "2" {
+		t.Errorf("Expected the count to be kept for K1, got %q", count)
+	}
+}
+
+func TestScript_Reload(t *testing.T) {
+	dir := scriptDir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := CreateAction(ActionScript, "K1", Env{Scripts: dir}, Params{"script": "missing.star"}); err == nil {
+		t.Error("Expected a missing script to be reported")
+	}
+	writeScript(t, dir, "broken.star", "if True\n")
+	if _, err := CreateAction(ActionScript, "K1", Env{Scripts: dir}, Params{"script": "broken.star"}); err == nil {
+		t.Error("Expected a script which does not compile to be reported")
+	}
+
+	out := make(chan ActionMessage, 10)
+	writeScript(t, dir, "notify.star", `notify("one")`)
+	a, err := CreateAction(ActionScript, "K1", Env{Out: out, Scripts: dir}, Params{"script": "notify.star"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Execute()
+	writeScript(t, dir, "notify.star", `notify("two, " + str(delta))`)
+	a.(TurnAction).Turn(context.Background(), -2)
+	writeScript(t, dir, "notify.star", `fail("three")`)
+	if err := a.Execute(); err == nil || !strings.Contains(err.Error(), "three") {
+		t.Errorf("Expected the script to fail, got %v", err)
+	}
+	if first, second := <-out, <-out; first.Notify != "one" || second.Notify != "two, -2" {
+		t.Errorf("Expected the script to be reloaded, got %q then %q", first.Notify, second.Notify)
+	}
+}
+
+func TestScript_Cancel(t *testing.T) {
+	dir := scriptDir(t)
+	defer os.RemoveAll(dir)
+
+	writeScript(t, dir, "sleep.star", `sleep(60)`)
+	writeScript(t, dir, "loop.star", "while True:\n    pass\n")
+	for _, script := range []string{"sleep.star", "loop.star"} {
+		a, err := CreateAction(ActionScript, "K1", Env{Scripts: dir}, Params{"script": script})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err := Execute(ctx, a); err != context.DeadlineExceeded {
+			t.Errorf("%s: expected the script to time out, got %v", script, err)
+		}
+		cancel()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- a.Execute()
+		}()
+		time.Sleep(20 * time.Millisecond)
+		a.Stop()
+		select {
+		case err := <-done:
+			if err != context.Canceled {
+				t.Errorf("%s: expected the script to be cancelled, got %v", script, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: expected Stop to cancel the script", script)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := scriptDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state", "store.json")
+
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("toggle/K1", 1); err != nil {
+		t.Fatal(err)
+	}
+	s, err = OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	if ok, err := s.Get("toggle/K1", &v); !ok || err != nil || v != 1 {
+		t.Errorf("Expected the value to be kept, got %v %v %d", ok, err, v)
+	}
+	if ok, _ := s.Get("toggle/K2", &v); ok {
+		t.Error("Did not expect a value for K2")
+	}
+}
@@ -0,0 +1,88 @@
+package pad
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store keeps values across restarts, saved as JSON in a file on every change
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	values map[string]json.RawMessage
+}
+
+// OpenStore loads the store saved at path, empty when the file does not exist
+// yet. Stores without a path are kept in memory.
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path, values: make(map[string]json.RawMessage)}
+	if len(path) == 0 {
+		return s, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.values); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get decodes the value of key into v, returning false when there is none
+func (s *Store) Get(key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.values[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// Set the value of key and save the store
+func (s *Store) Set(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = b
+	return s.save()
+}
+
+// Delete the value of key and save the store
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return s.save()
+}
+
+// save writes the values to a temporary file renamed over the store, so that
+// a crash does not leave it half written. It must be called with the lock
+// held.
+func (s *Store) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,108 @@
+package pad
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+// Opener opens the link to the pad, e.g. by discovering and opening its serial
+// port. Openers waiting for a pad give up when ctx is done.
+type Opener func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// A Supervisor keeps a pad attached to an orchestrator, reopening the link
+// whenever the pad is unplugged and plugged back in. Actions are left
+// untouched while the pad is away.
+type Supervisor struct {
+	// Retry is the delay between two attempts at opening the link
+	Retry time.Duration
+	// Codec wraps the link once opened, the legacy protocol is used when nil
+	Codec func(io.ReadWriter) (protocol.Codec, error)
+	// Device is the id the pad is attached as
+	Device string
+	orch   *Orchestrator
+	open   Opener
+	// ctx is cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewSupervisor returns a supervisor attaching links from open to o
+func NewSupervisor(o *Orchestrator, open Opener) *Supervisor {
+	s := new(Supervisor)
+	s.Retry = time.Second
+	s.Device = DefaultDevice
+	s.orch = o
+	s.open = open
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// Run opens and attaches the link until Stop is called
+func (s *Supervisor) Run() {
+	var lastErr string
+	for {
+		port, err := s.open(s.ctx)
+		if s.ctx.Err() != nil {
+			if err == nil {
+				port.Close()
+			}
+			return
+		}
+		if err != nil {
+			// Only log changes, a missing pad would otherwise fill the log
+			if err.Error() != lastErr {
+				log.Printf("Waiting for pad %s: %v\n", s.Device, err)
+				lastErr = err.Error()
+			}
+			select {
+			case <-time.After(s.Retry):
+				continue
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		lastErr = ""
+		codec, err := s.codec(port)
+		if err != nil {
+			log.Printf("Could not talk to pad %s: %v\n", s.Device, err)
+			port.Close()
+			select {
+			case <-time.After(s.Retry):
+				continue
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		done := s.orch.AttachDevice(s.Device, codec)
+		select {
+		case <-done:
+			port.Close()
+		case <-s.ctx.Done():
+			s.orch.DetachDevice(s.Device)
+			port.Close()
+			return
+		}
+		select {
+		case <-time.After(s.Retry):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Supervisor) codec(port io.ReadWriter) (protocol.Codec, error) {
+	if s.Codec == nil {
+		return protocol.NewLegacyCodec(port), nil
+	}
+	return s.Codec(port)
+}
+
+// Stop supervising and detach the pad, giving up on the link being opened.
+// It can be called more than once, before or after Run returns.
+func (s *Supervisor) Stop() {
+	s.cancel()
+}
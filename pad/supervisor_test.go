@@ -0,0 +1,106 @@
+package pad
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testPort struct {
+	in  *io.PipeReader
+	pad *io.PipeWriter
+	mu  sync.Mutex
+	out bytes.Buffer
+}
+
+func newTestPort() *testPort {
+	p := new(testPort)
+	p.in, p.pad = io.Pipe()
+	return p
+}
+
+func (p *testPort) Read(b []byte) (int, error) {
+	return p.in.Read(b)
+}
+
+func (p *testPort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.out.Write(b)
+}
+
+func (p *testPort) Close() error {
+	return p.in.Close()
+}
+
+func (p *testPort) written() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.out.String()
+}
+
+func TestSupervisorReconnect(t *testing.T) {
+	ports := make(chan *testPort, 2)
+	first, second := newTestPort(), newTestPort()
+	ports <- first
+	ports <- second
+
+	orch := NewOchestrator(nil)
+	go orch.Run()
+	defer orch.Shutdown()
+
+	s := NewSupervisor(orch, func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return <-ports, nil
+	})
+	s.Retry = time.Millisecond
+	go s.Run()
+	defer s.Stop()
+
+	time.Sleep(10 * time.Millisecond)
+	if orch.ConnectionState() != Connected {
+		t.Fatal("Expected the pad to be connected")
+	}
+	orch.Com <- ActionMessage{ActionName: "K1", State: 1}
+	time.Sleep(10 * time.Millisecond)
+	if first.written() != "K11\n" {
+		t.Errorf("Expected 'K11' on the first port, got '%s'", first.written())
+	}
+
+	// Unplug
+	first.pad.Close()
+	time.Sleep(10 * time.Millisecond)
+	if second.written() != "K11\n" {
+		t.Errorf("Expected LED state to be resent on reconnect, got '%s'", second.written())
+	}
+	if orch.ConnectionState() != Connected {
+		t.Error("Expected the pad to be connected again")
+	}
+}
+
+func TestSupervisorStop(t *testing.T) {
+	orch := NewOchestrator(nil)
+	defer orch.Shutdown()
+
+	// The opener waits for a pad which never comes
+	s := NewSupervisor(orch, func(ctx context.Context) (io.ReadWriteCloser, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	stopped := make(chan bool)
+	go func() {
+		s.Run()
+		close(stopped)
+	}()
+	s.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Stop to give up on the pending open")
+	}
+	// Nothing runs anymore, stopping again must not block
+	s.Stop()
+	orch.Shutdown()
+}
@@ -0,0 +1,159 @@
+package pad
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ActionToggle switches something on and off at every press
+const ActionToggle = "toggle"
+
+func init() {
+	RegisterActionKind(ActionKind{
+		Name:  ActionToggle,
+		Label: "Toggle",
+		Fields: []Field{
+			{Name: "on", Kind: FieldAction, Label: "On", Required: true},
+			{Name: "off", Kind: FieldAction, Label: "Off", Required: true},
+			{Name: "probe", Kind: FieldCondition, Label: "Probe"},
+		},
+		// pressing twice quickly must still switch on then off
+		Policy: Queue,
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionToggle(name, env, p.Action("on"), p.Action("off"), p.Condition("probe"))
+		},
+	})
+}
+
+// probeTimeout bounds the probe of the state of a toggle
+var probeTimeout = 10 * time.Second
+
+// toggleKey is the key of the store holding the state of the toggle name
+func toggleKey(name string) string {
+	return "toggle/" + name
+}
+
+// NewActionToggle configure and returns an action running the action described
+// by on, then the one described by off at the next press, and so on. The LED
+// of the binding tells which ran last, and the state is kept in env.Store
+// across restarts. When probe is set, it tells the actual state at creation,
+// holding when on.
+func NewActionToggle(name string, env Env, on *ActionConfig, off *ActionConfig, probe Condition) (Action, error) {
+	if len(probe.State) > 0 && env.State == nil {
+		return nil, fmt.Errorf("no states to check %s", probe.State)
+	}
+	if env.Store == nil {
+		env.Store, _ = OpenStore("")
+	}
+	a := &actionToggle{relay: newRelay(name, env.Out), store: env.Store, probed: make(chan bool)}
+	if _, err := a.store.Get(toggleKey(name), &a.on); err != nil {
+		log.Printf("Could not load the state of %s: %v\n", name, err)
+	}
+	state := env.State
+	env.Out = a.in
+	var err error
+	if a.onAction, err = CreateAction(on.Type, name+"#on", env, on.Params); err != nil {
+		a.Stop()
+		return nil, fmt.Errorf("on: %v", err)
+	}
+	if a.offAction, err = CreateAction(off.Type, name+"#off", env, off.Params); err != nil {
+		a.Stop()
+		return nil, fmt.Errorf("off: %v", err)
+	}
+	// the orchestrator only reads the messages once started
+	go a.init(probe, state)
+	return a, nil
+}
+
+type actionToggle struct {
+	*relay
+	store     *Store
+	onAction  Action
+	offAction Action
+	// probed is closed once the state is known
+	probed chan bool
+
+	// mu guards on, the state of the toggle
+	mu sync.Mutex
+	on bool
+}
+
+// init probes the actual state, if there is a probe, and lights the LED
+func (a *actionToggle) init(probe Condition, state func(name string) int8) {
+	if len(probe.Command) > 0 || len(probe.URL) > 0 || len(probe.State) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		on, err := probe.check(ctx, state)
+		cancel()
+		if err != nil {
+			log.Printf("Could not probe the state of %s: %v\n", a.name, err)
+		} else {
+			a.set(on)
+		}
+	}
+	a.mu.Lock()
+	msg := a.message()
+	a.mu.Unlock()
+	// the presses only wait for the state, not for the orchestrator
+	close(a.probed)
+	a.out <- msg
+}
+
+// set the state, keep it in the store and return the message lighting the LED
+func (a *actionToggle) set(on bool) ActionMessage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.on = on
+	if err := a.store.Set(toggleKey(a.name), on); err != nil {
+		log.Printf("Could not save the state of %s: %v\n", a.name, err)
+	}
+	return a.message()
+}
+
+// message lighting the LED with the state. It must be called with the lock
+// held.
+func (a *actionToggle) message() ActionMessage {
+	if a.on {
+		return ActionMessage{ActionName: a.name, State: 1}
+	}
+	return ActionMessage{ActionName: a.name, State: -1}
+}
+
+func (a *actionToggle) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+// ExecuteContext runs the action switching to the other state, which stays
+// the same when it fails. The presses wait for the probe.
+func (a *actionToggle) ExecuteContext(ctx context.Context) error {
+	select {
+	case <-a.probed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	a.mu.Lock()
+	on := !a.on
+	a.mu.Unlock()
+	next := a.offAction
+	if on {
+		next = a.onAction
+	}
+	if err := Execute(ctx, next); err != nil {
+		return err
+	}
+	a.out <- a.set(on)
+	return nil
+}
+
+// Stop the on and off actions
+func (a *actionToggle) Stop() {
+	if a.onAction != nil {
+		a.onAction.Stop()
+	}
+	if a.offAction != nil {
+		a.offAction.Stop()
+	}
+	a.close()
+}
@@ -0,0 +1,146 @@
+package pad
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestToggle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toggle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenStore(filepath.Join(dir, "store.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &stepLog{}
+	testSteps["on"] = &stepAction{name: "on", log: log}
+	testSteps["off"] = &stepAction{name: "off", log: log}
+	defer delete(testSteps, "on")
+	defer delete(testSteps, "off")
+	on := &ActionConfig{Type: "test", Params: Params{"name": "on"}}
+	off := &ActionConfig{Type: "test", Params: Params{"name": "off"}}
+
+	out := make(chan ActionMessage, 10)
+	a, err := NewActionToggle("K0", Env{Out: out, Store: store}, on, off, Condition{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-out; msg.ActionName != "K0" || msg.State != -1 {
+		t.Errorf("Expected K0 to start off, got %+v", msg)
+	}
+	for _, state := range []int8{1, -1, 1} {
+		if err := a.Execute(); err != nil {
+			t.Fatalf("Should have passed, got %v", err)
+		}
+		if msg := <-out; msg.ActionName != "K0" || msg.State != state {
+			t.Errorf("Expected K0 to have state %d, got %+v", state, msg)
+		}
+	}
+	if log.String() != "on,off,on" {
+		t.Errorf("Expected on,off,on to run, got %q", log)
+	}
+	a.Stop()
+
+	// the state is back after a restart
+	store, err = OpenStore(filepath.Join(dir, "store.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = NewActionToggle("K0", Env{Out: out, Store: store}, on, off, Condition{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-out; msg.State != 1 {
+		t.Errorf("Expected K0 to be back on, got %+v", msg)
+	}
+	if err := a.Execute(); err != nil {
+		t.Fatalf("Should have passed, got %v", err)
+	}
+	if msg := <-out; msg.State != -1 {
+		t.Errorf("Expected K0 to be switched off, got %+v", msg)
+	}
+	if log.String() != "on,off,on,off" {
+		t.Errorf("Expected off to run, got %q", log)
+	}
+	a.Stop()
+}
+
+func TestToggle_Failure(t *testing.T) {
+	log := &stepLog{}
+	failing := &stepAction{name: "on", log: log, fail: true}
+	testSteps["on"] = failing
+	testSteps["off"] = &stepAction{name: "off", log: log}
+	defer delete(testSteps, "on")
+	defer delete(testSteps, "off")
+
+	out := make(chan ActionMessage, 10)
+	a, err := NewActionToggle("K0", Env{Out: out}, &ActionConfig{Type: "test", Params: Params{"name": "on"}},
+		&ActionConfig{Type: "test", Params: Params{"name": "off"}}, Condition{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-out; msg.State != -1 {
+		t.Errorf("Expected K0 to start off, got %+v", msg)
+	}
+	if err := a.Execute(); err == nil {
+		t.Error("Should have failed")
+	}
+	failing.fail = false
+	if err := a.Execute(); err != nil {
+		t.Fatalf("Should have passed, got %v", err)
+	}
+	if msg := <-out; msg.State != 1 {
+		t.Errorf("Expected K0 to be switched on once on passed, got %+v", msg)
+	}
+	a.Stop()
+}
+
+func TestToggle_Probe(t *testing.T) {
+	oldBuilder := builder
+	defer func() { builder = oldBuilder }()
+
+	builder = testActionCommandBuilder{}
+
+	log := &stepLog{}
+	testSteps["on"] = &stepAction{name: "on", log: log}
+	testSteps["off"] = &stepAction{name: "off", log: log}
+	defer delete(testSteps, "on")
+	defer delete(testSteps, "off")
+	on := &ActionConfig{Type: "test", Params: Params{"name": "on"}}
+	off := &ActionConfig{Type: "test", Params: Params{"name": "off"}}
+
+	store, _ := OpenStore("")
+	store.Set(toggleKey("K0"), false)
+	out := make(chan ActionMessage, 10)
+	a, err := NewActionToggle("K0", Env{Out: out, Store: store}, on, off, Condition{Command: []string{"open"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-out; msg.State != 1 {
+		t.Errorf("Expected the probe to switch K0 on, got %+v", msg)
+	}
+	if err := a.Execute(); err != nil {
+		t.Fatalf("Should have passed, got %v", err)
+	}
+	if msg := <-out; msg.State != -1 {
+		t.Errorf("Expected K0 to be switched off, got %+v", msg)
+	}
+	if log.String() != "off" {
+		t.Errorf("Expected off to run, got %q", log)
+	}
+	a.Stop()
+
+	a, err = NewActionToggle("K0", Env{Out: out, Store: store}, on, off, Condition{Command: []string{"false"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-out; msg.State != -1 {
+		t.Errorf("Expected the probe to switch K0 off, got %+v", msg)
+	}
+	a.Stop()
+}
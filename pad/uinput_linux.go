@@ -0,0 +1,223 @@
+package pad
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Requests and events of the uinput module, see linux/uinput.h and
+// linux/input-event-codes.h
+const (
+	uiSetEvBit  = 0x40045564
+	uiSetKeyBit = 0x40045565
+	uiDevCreate = 0x5501
+	evSyn       = 0x00
+	evKey       = 0x01
+	synReport   = 0
+	keyShift    = 42
+	maxKeyCode  = 255
+)
+
+// uinputPath is the device creating virtual devices
+var uinputPath = "/dev/uinput"
+
+type uinputUserDev struct {
+	Name       [80]byte
+	ID         struct{ Bustype, Vendor, Product, Version uint16 }
+	EffectsMax uint32
+	Absmax     [64]int32
+	Absmin     [64]int32
+	Absfuzz    [64]int32
+	Absflat    [64]int32
+}
+
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// uinput types on a virtual keyboard with a US layout, created on the first
+// keystrokes. The user needs write access to /dev/uinput.
+type uinput struct {
+	mu  sync.Mutex
+	dev *os.File
+}
+
+func (*uinput) String() string {
+	return "uinput"
+}
+
+func newUinput() Injector {
+	return &uinput{}
+}
+
+func (u *uinput) Check(strokes []Keystroke) error {
+	for _, s := range strokes {
+		if _, err := uinputCodes(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uinputCodes returns the codes of the keys of a keystroke with whether they
+// need shift
+func uinputCodes(s Keystroke) ([]charKey, error) {
+	switch s.Kind {
+	case StrokeWait:
+		return nil, nil
+	case StrokeText:
+		var keys []charKey
+		for _, c := range s.Text {
+			k, ok := charKeys[c]
+			if !ok {
+				return nil, fmt.Errorf("uinput: cannot type %q", c)
+			}
+			keys = append(keys, k)
+		}
+		return keys, nil
+	}
+	k, err := injectedKey("uinput", s)
+	if err == nil && k.code == 0 {
+		err = orUnsupported(nil, "uinput", s)
+	}
+	return []charKey{{code: k.code}}, err
+}
+
+func (u *uinput) Inject(ctx context.Context, strokes []Keystroke) (err error) {
+	if err = u.Check(strokes); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.dev == nil {
+		dev, err := createKeyboard()
+		if err != nil {
+			return fmt.Errorf("uinput: %v", err)
+		}
+		u.dev = dev
+	}
+	var held heldKeys
+	defer func() {
+		if err != nil {
+			held.release(func(up Keystroke) error {
+				keys, _ := uinputCodes(up)
+				for _, k := range keys {
+					if err := u.send(k.code, 0); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+	}()
+	for _, s := range strokes {
+		if s.Kind == StrokeWait {
+			if err = sleep(ctx, s.Wait); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.Kind == StrokeDown {
+			held = append(held, s)
+		}
+		keys, _ := uinputCodes(s)
+		for _, k := range keys {
+			switch s.Kind {
+			case StrokeDown:
+				err = u.send(k.code, 1)
+			case StrokeUp:
+				err = u.send(k.code, 0)
+			default:
+				err = u.press(k.code, k.shift)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if s.Kind == StrokeUp {
+			held = held.up(s)
+		}
+	}
+	return nil
+}
+
+// press and release the key with code, within shift when shift is true
+func (u *uinput) press(code uint16, shift bool) error {
+	var events []inputEvent
+	if shift {
+		events = append(events, keyEvents(keyShift, 1)...)
+	}
+	events = append(events, keyEvents(code, 1)...)
+	events = append(events, keyEvents(code, 0)...)
+	if shift {
+		events = append(events, keyEvents(keyShift, 0)...)
+	}
+	return u.write(events)
+}
+
+func (u *uinput) send(code uint16, value int32) error {
+	return u.write(keyEvents(code, value))
+}
+
+func (u *uinput) write(events []inputEvent) error {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, events)
+	_, err := u.dev.Write(b.Bytes())
+	return err
+}
+
+// keyEvents returns the events of a key going down (1) or up (0)
+func keyEvents(code uint16, value int32) []inputEvent {
+	return []inputEvent{{Type: evKey, Code: code, Value: value}, {Type: evSyn, Code: synReport}}
+}
+
+// createKeyboard creates a virtual device sending every key
+func createKeyboard() (*os.File, error) {
+	f, err := os.OpenFile(uinputPath, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioctl(f, uiSetEvBit, evKey); err != nil {
+		f.Close()
+		return nil, err
+	}
+	for code := 1; code <= maxKeyCode; code++ {
+		if err := ioctl(f, uiSetKeyBit, uintptr(code)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	var dev uinputUserDev
+	copy(dev.Name[:], "macropad")
+	dev.ID.Bustype = 0x03 // BUS_USB
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, dev)
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := ioctl(f, uiDevCreate, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Leave the desktop the time to notice the new keyboard
+	time.Sleep(200 * time.Millisecond)
+	return f, nil
+}
+
+func ioctl(f *os.File, request uintptr, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+package pad
+
+import (
+	"context"
+	"fmt"
+)
+
+// uinput is only available on Linux
+type uinput struct{}
+
+func (uinput) String() string {
+	return "uinput"
+}
+
+func newUinput() Injector {
+	return uinput{}
+}
+
+func (uinput) Inject(ctx context.Context, strokes []Keystroke) error {
+	return fmt.Errorf("uinput: only available on Linux")
+}
+
+func (uinput) Check(strokes []Keystroke) error {
+	return fmt.Errorf("uinput: only available on Linux")
+}
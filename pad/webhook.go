@@ -0,0 +1,184 @@
+package pad
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ActionHTTP sends a request to a URL
+const ActionHTTP = "http"
+
+func init() {
+	RegisterActionKind(ActionKind{
+		Name:  ActionHTTP,
+		Label: "HTTP",
+		Fields: []Field{
+			{Name: "method", Kind: FieldChoice, Label: "Method", Choices: []string{"POST", "GET", "PUT", "PATCH", "DELETE"}},
+			{Name: "url", Kind: FieldString, Label: "URL", Required: true},
+			{Name: "headers", Kind: FieldMap, Label: "Headers"},
+			{Name: "body", Kind: FieldString, Label: "Body"},
+			{Name: "status", Kind: FieldInt, Label: "Expected status"},
+			{Name: "notify", Kind: FieldString, Label: "Notification"},
+		},
+		New: func(name string, env Env, p Params) (Action, error) {
+			return NewActionHTTP(name, env.Out, p.String("method"), p.String("url"), p.Map("headers"),
+				p.String("body"), p.Int("status"), p.String("notify"))
+		},
+		Check: func(p Params) error {
+			_, err := parseTemplates(p.String("url"), p.String("body"), p.String("notify"))
+			return err
+		},
+	})
+}
+
+// httpTimeout bounds the requests of the bindings without a timeout
+var httpTimeout = 10 * time.Second
+
+// maxResponse is the size of the responses read for the notifications and
+// the errors
+const maxResponse = 1 << 20
+
+// requestData is what the URL and the body of a request are templated with
+type requestData struct {
+	Name  string
+	Time  time.Time
+	Delta int
+	Value int
+}
+
+// responseData is what the notification of a response is templated with,
+// JSON holding the body when it is JSON
+type responseData struct {
+	Status     string
+	StatusCode int
+	Body       string
+	JSON       interface{}
+}
+
+// NewActionHTTP configure and returns an action sending a method request to
+// url with headers and body, both text/template templates given the Name of
+// the binding, the Time and, for encoders and sliders, the Delta or the
+// Value. The response must have status, any 2xx when zero. When notify is set,
+// it is the template of a notification of the response.
+func NewActionHTTP(name string, out chan<- ActionMessage, method string, url string, headers map[string]string,
+	body string, status int, notify string) (Action, error) {
+	a := &actionHTTP{name: name, out: out, method: method, headers: headers, status: status}
+	if len(a.method) == 0 {
+		a.method = http.MethodPost
+	}
+	t, err := parseTemplates(url, body, notify)
+	if err != nil {
+		return nil, err
+	}
+	a.url, a.body, a.notify = t[0], t[1], t[2]
+	return a, nil
+}
+
+// parseTemplates of the URL, the body and the notification, nil when empty
+func parseTemplates(url string, body string, notify string) ([]*template.Template, error) {
+	var templates []*template.Template
+	for _, t := range []struct{ name, text string }{{"url", url}, {"body", body}, {"notify", notify}} {
+		if len(t.text) == 0 {
+			templates = append(templates, nil)
+			continue
+		}
+		parsed, err := template.New(t.name).Parse(t.text)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, parsed)
+	}
+	return templates, nil
+}
+
+type actionHTTP struct {
+	name    string
+	out     chan<- ActionMessage
+	method  string
+	url     *template.Template
+	headers map[string]string
+	body    *template.Template
+	status  int
+	notify  *template.Template
+}
+
+func (a *actionHTTP) Execute() error {
+	return a.ExecuteContext(context.Background())
+}
+
+func (a *actionHTTP) ExecuteContext(ctx context.Context) error {
+	return a.send(ctx, requestData{})
+}
+
+// Turn sends the request with the steps of the encoder as Delta
+func (a *actionHTTP) Turn(ctx context.Context, delta int) error {
+	return a.send(ctx, requestData{Delta: delta})
+}
+
+// SetValue sends the request with the analog value as Value
+func (a *actionHTTP) SetValue(ctx context.Context, value int) error {
+	return a.send(ctx, requestData{Value: value})
+}
+
+func (a *actionHTTP) send(ctx context.Context, data requestData) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, httpTimeout)
+		defer cancel()
+	}
+	data.Name = a.name
+	data.Time = time.Now()
+	var url, body bytes.Buffer
+	if err := a.url.Execute(&url, data); err != nil {
+		return err
+	}
+	if a.body != nil {
+		if err := a.body.Execute(&body, data); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(a.method, url.String(), &body)
+	if err != nil {
+		return err
+	}
+	for k, v := range a.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+	if (a.status == 0 && resp.StatusCode/100 != 2) || (a.status != 0 && resp.StatusCode != a.status) {
+		return fmt.Errorf("%s %s: %s %s", a.method, url.String(), resp.Status, strings.TrimSpace(string(b)))
+	}
+	if a.notify == nil {
+		return nil
+	}
+	r := responseData{Status: resp.Status, StatusCode: resp.StatusCode, Body: string(b)}
+	json.Unmarshal(b, &r.JSON)
+	var notification bytes.Buffer
+	if err := a.notify.Execute(&notification, r); err != nil {
+		return err
+	}
+	a.out <- ActionMessage{ActionName: a.name, Notify: notification.String()}
+	return nil
+}
+
+func (a *actionHTTP) Stop() {
+}
@@ -0,0 +1,105 @@
+package pad
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	var method, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		method, auth, body = r.Method, r.Header.Get("Authorization"), string(b)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"id": 42}`))
+	}))
+	defer server.Close()
+
+	out := make(chan ActionMessage, 1)
+	a, err := CreateAction(ActionHTTP, "K1", Env{Out: out}, Params{
+		"url":     server.URL + "/deploy",
+		"headers": map[string]interface{}{"Authorization": "Bearer token"},
+		"body":    `{"key": "{{.Name}}"}`,
+		"notify":  "Deploy {{.JSON.id}} {{.Status}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Execute(); err != nil {
+		t.Fatalf("Should have passed, got %v", err)
+	}
+	if method != http.MethodPost || auth != "Bearer token" || body != `{"key": "K1"}` {
+		t.Errorf("Unexpected request %s %q %s", method, auth, body)
+	}
+	if msg := <-out; msg.Notify != "Deploy 42 200 OK" {
+		t.Errorf("Expected the notification of the response, got %q", msg.Notify)
+	}
+
+	a, _ = CreateAction(ActionHTTP, "K1", Env{Out: out}, Params{"method": "GET", "url": server.URL + "/missing"})
+	if err := a.Execute(); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected the action to fail on 404, got %v", err)
+	}
+	if method != http.MethodGet {
+		t.Errorf("Expected a GET, got %s", method)
+	}
+	a, _ = CreateAction(ActionHTTP, "K1", Env{Out: out}, Params{"url": server.URL + "/missing", "status": 404})
+	if err := a.Execute(); err != nil {
+		t.Errorf("Expected 404 to be expected, got %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("Did not expect a notification, got %v", <-out)
+	}
+}
+
+func TestHTTP_Turn(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	}))
+	defer server.Close()
+
+	a, err := CreateAction(ActionHTTP, "E0", Env{}, Params{"method": "PUT", "url": server.URL + "/volume?delta={{.Delta}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.(TurnAction).Turn(context.Background(), -3); err != nil {
+		t.Fatal(err)
+	}
+	if query != "delta=-3" {
+		t.Errorf("Expected the delta in the URL, got %s", query)
+	}
+}
+
+func TestHTTP_Timeout(t *testing.T) {
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	a, err := CreateAction(ActionHTTP, "K1", Env{}, Params{"url": server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Execute(ctx, a); err != context.DeadlineExceeded {
+		t.Errorf("Expected the request to time out, got %v", err)
+	}
+
+	if err := CheckAction(ActionHTTP, Params{"url": "http://localhost", "body": "{{.Name"}); err == nil {
+		t.Error("Expected an invalid template to be rejected")
+	}
+	if err := CheckAction(ActionHTTP, Params{"url": "http://localhost", "method": "HEAD"}); err == nil {
+		t.Error("Expected an unknown method to be rejected")
+	}
+}
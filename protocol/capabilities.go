@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Capabilities of a pad, reported as HELLO attributes:
+//
+//	keys=<n>        number of keys, named K0 to K<n-1>
+//	layers=<n>      number of layers handled by the firmware
+//	led=<type>      none, mono or rgb
+//	encoders=<n>    number of rotary encoders, named E0 to E<n-1>
+//	analog=<n>      number of analog inputs, named A0 to A<n-1>
+//	displays=<n>    number of displays
+//	fw=<version>    firmware version
+type Capabilities struct {
+	Keys     int    `json:"keys"`
+	Layers   int    `json:"layers"`
+	LED      string `json:"led"`
+	Encoders int    `json:"encoders"`
+	Analog   int    `json:"analog"`
+	Displays int    `json:"displays"`
+	Firmware string `json:"firmware"`
+}
+
+// LegacyCapabilities are assumed for pads which cannot report theirs: ten keys
+// on two layers, the second one being addressed as K1<n>
+var LegacyCapabilities = Capabilities{Keys: 10, Layers: 2, LED: "mono", Firmware: "legacy"}
+
+// ParseCapabilities reads the capabilities from HELLO attributes, missing
+// attributes are taken from LegacyCapabilities
+func ParseCapabilities(attrs map[string]string) (Capabilities, error) {
+	c := LegacyCapabilities
+	c.Firmware = "unknown"
+	ints := map[string]*int{"keys": &c.Keys, "layers": &c.Layers, "encoders": &c.Encoders, "analog": &c.Analog, "displays": &c.Displays}
+	for name, v := range ints {
+		s, ok := attrs[name]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("invalid %s capability %q", name, s)
+		}
+		*v = n
+	}
+	if led, ok := attrs["led"]; ok {
+		c.LED = led
+	}
+	if fw, ok := attrs["fw"]; ok {
+		c.Firmware = fw
+	}
+	return c, nil
+}
+
+// CapabilitiesOf returns the capabilities reported by the pad on the other
+// end of the codec
+func CapabilitiesOf(c Codec) (Capabilities, error) {
+	f, ok := c.(*framed)
+	if !ok || f.hello == nil {
+		return LegacyCapabilities, nil
+	}
+	return ParseCapabilities(f.hello.Attrs)
+}
@@ -0,0 +1,36 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	c, err := ParseCapabilities(map[string]string{"keys": "12", "layers": "3", "led": "rgb", "encoders": "1", "analog": "2", "fw": "2.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Capabilities{Keys: 12, Layers: 3, LED: "rgb", Encoders: 1, Analog: 2, Firmware: "2.0.1"}
+	if c != expected {
+		t.Errorf("Expected %+v, got %+v", expected, c)
+	}
+	if _, err = ParseCapabilities(map[string]string{"keys": "many"}); err == nil {
+		t.Error("Expected invalid key count to be rejected")
+	}
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	c, _ := CapabilitiesOf(NewLegacyCodec(newRw("")))
+	if c != LegacyCapabilities {
+		t.Errorf("Expected legacy capabilities, got %+v", c)
+	}
+	hello := FormatFrame(&Message{Type: Hello, Attrs: map[string]string{"version": "1", "keys": "4", "fw": "1.1"}})
+	codec, err := Negotiate(newRw(hello+"\n"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ = CapabilitiesOf(codec)
+	if c.Keys != 4 || c.Firmware != "1.1" || c.Layers != 2 {
+		t.Errorf("Unexpected capabilities %+v", c)
+	}
+}
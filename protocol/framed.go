@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version of the framed protocol
+const Version = 1
+
+// maxPending is the number of unacknowledged frames kept for retransmission
+const maxPending = 32
+
+type framed struct {
+	lines   *lineReader
+	out     io.Writer
+	hello   *Message
+	mu      sync.Mutex
+	seq     uint16
+	pending map[uint16]string
+	order   []uint16
+	last    string
+}
+
+// NewFramedCodec returns a framed codec without going through the handshake,
+// e.g. for the pad side of the link
+func NewFramedCodec(rw io.ReadWriter) Codec {
+	return newFramed(newLineReader(rw), rw)
+}
+
+func newFramed(lr *lineReader, out io.Writer) *framed {
+	return &framed{lines: lr, out: out, pending: make(map[uint16]string)}
+}
+
+func (f *framed) Version() int {
+	return Version
+}
+
+func (f *framed) ReadMessage() (*Message, error) {
+	for {
+		line, err := f.lines.next(0)
+		if err != nil {
+			return nil, err
+		}
+		m, err := f.receive(line)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if m != nil {
+			return m, nil
+		}
+	}
+}
+
+// receive handles acknowledgements, returning the message to deliver if any
+func (f *framed) receive(line string) (*Message, error) {
+	m, err := ParseFrame(line)
+	if err != nil {
+		if seq, ok := frameSeq(line); ok {
+			f.send(&Message{Type: Nack, Seq: seq})
+		}
+		return nil, err
+	}
+	switch m.Type {
+	case Ack:
+		f.mu.Lock()
+		delete(f.pending, m.Seq)
+		f.mu.Unlock()
+		return nil, nil
+	case Nack:
+		f.mu.Lock()
+		frame, ok := f.pending[m.Seq]
+		f.mu.Unlock()
+		if ok {
+			_, err = f.out.Write([]byte(frame + "\n"))
+		}
+		return nil, err
+	}
+	if err = f.send(&Message{Type: Ack, Seq: m.Seq}); err != nil {
+		return nil, err
+	}
+	if line == f.last {
+		// Retransmission of a frame whose ACK got lost
+		return nil, nil
+	}
+	f.last = line
+	return m, nil
+}
+
+func (f *framed) WriteMessage(m *Message) error {
+	f.mu.Lock()
+	m.Seq = f.seq
+	f.seq++
+	f.mu.Unlock()
+	return f.send(m)
+}
+
+func (f *framed) send(m *Message) error {
+	frame := FormatFrame(m)
+	if m.Type != Ack && m.Type != Nack {
+		f.mu.Lock()
+		f.pending[m.Seq] = frame
+		f.order = append(f.order, m.Seq)
+		if len(f.order) > maxPending {
+			delete(f.pending, f.order[0])
+			f.order = f.order[1:]
+		}
+		f.mu.Unlock()
+	}
+	_, err := f.out.Write([]byte(frame + "\n"))
+	return err
+}
+
+func checksum(s string) string {
+	var c byte
+	for i := 0; i < len(s); i++ {
+		c ^= s[i]
+	}
+	return fmt.Sprintf("%02X", c)
+}
+
+// FormatFrame encodes a message as a frame, without the newline
+func FormatFrame(m *Message) string {
+	fields := []string{strconv.Itoa(Version), strconv.Itoa(int(m.Seq)), string(m.Type)}
+	switch m.Type {
+	case Key, LED, Progress, Encoder, Analog:
+		fields = append(fields, m.Key, strconv.Itoa(m.Value))
+	case Hello:
+		fields = append(fields, attrs(m.Attrs)...)
+	}
+	body := strings.Join(fields, "|")
+	return "~" + body + "*" + checksum(body)
+}
+
+func frameSeq(line string) (uint16, bool) {
+	fields := strings.SplitN(strings.TrimPrefix(line, "~"), "|", 3)
+	if len(fields) < 3 {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(fields[1], 10, 16)
+	return uint16(seq), err == nil
+}
+
+// ParseFrame decodes a frame, checking its checksum
+func ParseFrame(line string) (*Message, error) {
+	star := strings.LastIndex(line, "*")
+	if !strings.HasPrefix(line, "~") || star < 0 {
+		return nil, fmt.Errorf("malformed frame %q", line)
+	}
+	body := line[1:star]
+	if checksum(body) != strings.ToUpper(line[star+1:]) {
+		return nil, fmt.Errorf("invalid checksum in frame %q", line)
+	}
+	fields := strings.Split(body, "|")
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed frame %q", line)
+	}
+	if fields[0] != strconv.Itoa(Version) {
+		return nil, fmt.Errorf("unsupported version in frame %q", line)
+	}
+	seq, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("malformed sequence number in frame %q", line)
+	}
+	m := &Message{Type: Type(fields[2]), Seq: uint16(seq)}
+	args := fields[3:]
+	switch m.Type {
+	case Key, LED, Progress, Encoder, Analog:
+		if len(args) != 2 {
+			return nil, fmt.Errorf("malformed %s frame %q", m.Type, line)
+		}
+		m.Key = args[0]
+		if m.Value, err = strconv.Atoi(args[1]); err != nil {
+			return nil, fmt.Errorf("malformed value in frame %q", line)
+		}
+	case Hello:
+		m.Attrs = make(map[string]string)
+		for _, a := range args {
+			kv := strings.SplitN(a, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("malformed attribute %q in frame %q", a, line)
+			}
+			m.Attrs[kv[0]] = kv[1]
+		}
+	case Ack, Nack:
+	default:
+		return nil, fmt.Errorf("unknown message type in frame %q", line)
+	}
+	return m, nil
+}
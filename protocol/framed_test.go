@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	msgs := []*Message{
+		{Type: Key, Seq: 3, Key: "K2", Value: 1},
+		{Type: LED, Seq: 65535, Key: "K0", Value: 0},
+		{Type: Progress, Seq: 7, Key: "K4", Value: 255},
+		{Type: Encoder, Seq: 8, Key: "E0", Value: -2},
+		{Type: Analog, Seq: 9, Key: "A1", Value: 1023},
+		{Type: Hello, Attrs: map[string]string{"version": "1", "fw": "0.3"}},
+		{Type: Ack, Seq: 12},
+	}
+	for _, m := range msgs {
+		frame := FormatFrame(m)
+		p, err := ParseFrame(frame)
+		if err != nil {
+			t.Errorf("Could not parse %q: %v", frame, err)
+			continue
+		}
+		if p.String() != m.String() || p.Seq != m.Seq {
+			t.Errorf("Expected %v, got %v", m, p)
+		}
+	}
+	if f := FormatFrame(&Message{Type: LED, Seq: 1, Key: "K0", Value: 1}); f != "~1|1|LED|K0|1*"+checksum("1|1|LED|K0|1") {
+		t.Errorf("Unexpected frame %q", f)
+	}
+}
+
+func TestParseFrame_Invalid(t *testing.T) {
+	good := FormatFrame(&Message{Type: Key, Seq: 1, Key: "K0", Value: 1})
+	bad := []string{
+		strings.Replace(good, "K0", "K1", 1),
+		"~1|1|KEY|K0|1",
+		"1|1|KEY|K0|1*00",
+		"~2|1|KEY|K0|1*" + checksum("2|1|KEY|K0|1"),
+		"~1|1|FOO*" + checksum("1|1|FOO"),
+		"~1|1|KEY|K0*" + checksum("1|1|KEY|K0"),
+	}
+	for _, line := range bad {
+		if _, err := ParseFrame(line); err == nil {
+			t.Errorf("Expected %q to be rejected", line)
+		}
+	}
+}
+
+func TestFramedCodec(t *testing.T) {
+	press := FormatFrame(&Message{Type: Key, Seq: 5, Key: "K1", Value: 1})
+	corrupted := strings.Replace(FormatFrame(&Message{Type: Key, Seq: 6, Key: "K1", Value: 0}), "K1", "K2", 1)
+	s := newRw(press + "\n" + press + "\n" + corrupted + "\n")
+	c := NewFramedCodec(s)
+
+	m, err := c.ReadMessage()
+	if err != nil || !m.Pressed() || m.Key != "K1" {
+		t.Errorf("Expected K1 pressed, got %v (%v)", m, err)
+	}
+	// The duplicate is acknowledged but not delivered, the corrupted frame is rejected
+	if m, err = c.ReadMessage(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v (%v)", m, err)
+	}
+	expected := strings.Join([]string{
+		FormatFrame(&Message{Type: Ack, Seq: 5}),
+		FormatFrame(&Message{Type: Ack, Seq: 5}),
+		FormatFrame(&Message{Type: Nack, Seq: 6}),
+	}, "\n") + "\n"
+	if s.out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, s.out.String())
+	}
+}
+
+func TestFramedCodec_Retransmit(t *testing.T) {
+	s := newRw(FormatFrame(&Message{Type: Nack, Seq: 0}) + "\n")
+	c := NewFramedCodec(s)
+	c.WriteMessage(&Message{Type: LED, Key: "K0", Value: 1})
+	c.ReadMessage()
+	frame := FormatFrame(&Message{Type: LED, Seq: 0, Key: "K0", Value: 1})
+	if s.out.String() != frame+"\n"+frame+"\n" {
+		t.Errorf("Expected the frame to be sent twice, got %q", s.out.String())
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	hello := FormatFrame(&Message{Type: Hello, Attrs: map[string]string{"version": "1"}})
+	c, err := Negotiate(newRw(hello+"\n"), time.Second)
+	if err != nil || c.Version() != 1 {
+		t.Errorf("Expected the framed codec, got %v (%v)", c, err)
+	}
+
+	s := newRw("K00\n")
+	c, err = Negotiate(s, time.Second)
+	if err != nil || c.Version() != 0 {
+		t.Fatalf("Expected the legacy codec, got %v (%v)", c, err)
+	}
+	m, err := c.ReadMessage()
+	if err != nil || !m.Pressed() || m.Key != "K0" {
+		t.Errorf("Expected the first line to be kept, got %v (%v)", m, err)
+	}
+
+	r, _ := io.Pipe()
+	c, err = Negotiate(&readWriter{r, io.Discard}, 10*time.Millisecond)
+	if err != nil || c.Version() != 0 {
+		t.Errorf("Expected a silent pad to fall back to legacy, got %v (%v)", c, err)
+	}
+}
+
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
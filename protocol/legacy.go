@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+type legacy struct {
+	lines  *lineReader
+	out    io.Writer
+	unread []string
+}
+
+// NewLegacyCodec returns a codec speaking the original line format
+func NewLegacyCodec(rw io.ReadWriter) Codec {
+	return newLegacy(newLineReader(rw), rw)
+}
+
+func newLegacy(lr *lineReader, out io.Writer) *legacy {
+	return &legacy{lines: lr, out: out}
+}
+
+func (l *legacy) Version() int {
+	return 0
+}
+
+func (l *legacy) ReadMessage() (*Message, error) {
+	for {
+		var line string
+		if len(l.unread) > 0 {
+			line, l.unread = l.unread[0], l.unread[1:]
+		} else {
+			var err error
+			line, err = l.lines.next(0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		m, err := ParseLegacy(line)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		return m, nil
+	}
+}
+
+func (l *legacy) WriteMessage(m *Message) error {
+	line, err := FormatLegacy(m)
+	if err != nil {
+		return err
+	}
+	_, err = l.out.Write([]byte(line + "\n"))
+	return err
+}
+
+// ParseLegacy decodes a line sent by a legacy pad
+func ParseLegacy(line string) (*Message, error) {
+	if len(line) < 3 || strings.IndexByte("KEA", line[0]) < 0 {
+		return nil, fmt.Errorf("malformed line %q", line)
+	}
+	if i := strings.IndexAny(line, "+-="); i > 0 {
+		return parseLegacyInput(line, i)
+	}
+	if line[0] == 'A' {
+		return nil, fmt.Errorf("malformed line %q", line)
+	}
+	key, state := line[:len(line)-1], line[len(line)-1]
+	if _, err := strconv.Atoi(key[1:]); err != nil {
+		return nil, fmt.Errorf("malformed key in line %q", line)
+	}
+	switch state {
+	case '0':
+		return &Message{Type: Key, Key: key, Value: 1}, nil
+	case '1':
+		return &Message{Type: Key, Key: key, Value: 0}, nil
+	}
+	return nil, fmt.Errorf("malformed state in line %q", line)
+}
+
+// parseLegacyInput decodes encoder steps and analog values, i being the index
+// of the sign or of the equal sign
+func parseLegacyInput(line string, i int) (*Message, error) {
+	input, sign, value := line[:i], line[i], line[i+1:]
+	if _, err := strconv.Atoi(input[1:]); err != nil {
+		return nil, fmt.Errorf("malformed input in line %q", line)
+	}
+	if input[0] == 'A' && sign == '=' {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("malformed value in line %q", line)
+		}
+		return &Message{Type: Analog, Key: input, Value: n}, nil
+	}
+	if input[0] != 'E' || sign == '=' {
+		return nil, fmt.Errorf("malformed line %q", line)
+	}
+	steps := 1
+	if len(value) > 0 {
+		var err error
+		if steps, err = strconv.Atoi(value); err != nil || steps < 0 {
+			return nil, fmt.Errorf("malformed steps in line %q", line)
+		}
+	}
+	if sign == '-' {
+		steps = -steps
+	}
+	return &Message{Type: Encoder, Key: input, Value: steps}, nil
+}
+
+// FormatLegacy encodes a message in the legacy line format, without the newline
+func FormatLegacy(m *Message) (string, error) {
+	switch m.Type {
+	case LED:
+		if m.Value == 1 {
+			return m.Key + "1", nil
+		}
+		return m.Key + "0", nil
+	case Progress:
+		return fmt.Sprintf("%s-%d", strings.Replace(m.Key, "K", "P", 1), m.Value), nil
+	}
+	return "", fmt.Errorf("%s messages are not supported by the legacy protocol", m.Type)
+}
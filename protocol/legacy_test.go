@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type rw struct {
+	in  *strings.Reader
+	out *bytes.Buffer
+}
+
+func (s *rw) Read(p []byte) (int, error) {
+	return s.in.Read(p)
+}
+
+func (s *rw) Write(p []byte) (int, error) {
+	return s.out.Write(p)
+}
+
+func newRw(in string) *rw {
+	return &rw{in: strings.NewReader(in), out: new(bytes.Buffer)}
+}
+
+func TestParseLegacy(t *testing.T) {
+	m, err := ParseLegacy("K30")
+	if err != nil || !m.Pressed() || m.Key != "K3" {
+		t.Errorf("Expected K3 pressed, got %v (%v)", m, err)
+	}
+	m, err = ParseLegacy("K121")
+	if err != nil || m.Pressed() || m.Key != "K12" {
+		t.Errorf("Expected K12 released, got %v (%v)", m, err)
+	}
+	m, err = ParseLegacy("E0-3")
+	if err != nil || m.Type != Encoder || m.Key != "E0" || m.Value != -3 {
+		t.Errorf("Expected E0 turned 3 steps counter-clockwise, got %v (%v)", m, err)
+	}
+	m, err = ParseLegacy("E1+")
+	if err != nil || m.Type != Encoder || m.Value != 1 {
+		t.Errorf("Expected E1 turned 1 step clockwise, got %v (%v)", m, err)
+	}
+	m, err = ParseLegacy("E00")
+	if err != nil || m.Type != Key || !m.Pressed() || m.Key != "E0" {
+		t.Errorf("Expected the push of E0, got %v (%v)", m, err)
+	}
+	m, err = ParseLegacy("A0=512")
+	if err != nil || m.Type != Analog || m.Key != "A0" || m.Value != 512 {
+		t.Errorf("Expected A0 at 512, got %v (%v)", m, err)
+	}
+	for _, line := range []string{"", "K", "K1", "X10", "Kx0", "K12", "A01", "A0+1", "E0=1", "E0+x", "Ex+1"} {
+		if _, err = ParseLegacy(line); err == nil {
+			t.Errorf("Expected %q to be rejected", line)
+		}
+	}
+}
+
+func TestFormatLegacy(t *testing.T) {
+	tests := []struct {
+		m    Message
+		line string
+	}{
+		{Message{Type: LED, Key: "K1", Value: 1}, "K11"},
+		{Message{Type: LED, Key: "K12", Value: 0}, "K120"},
+		{Message{Type: Progress, Key: "K3", Value: 128}, "P3-128"},
+	}
+	for _, test := range tests {
+		line, err := FormatLegacy(&test.m)
+		if err != nil || line != test.line {
+			t.Errorf("Expected %q, got %q (%v)", test.line, line, err)
+		}
+	}
+	if _, err := FormatLegacy(&Message{Type: Hello}); err == nil {
+		t.Error("Expected HELLO to be unsupported")
+	}
+}
+
+func TestLegacyCodec(t *testing.T) {
+	s := newRw("K00\ngarbage\nK01\n")
+	c := NewLegacyCodec(s)
+	m, err := c.ReadMessage()
+	if err != nil || !m.Pressed() || m.Key != "K0" {
+		t.Errorf("Expected K0 pressed, got %v (%v)", m, err)
+	}
+	m, err = c.ReadMessage()
+	if err != nil || m.Pressed() || m.Key != "K0" {
+		t.Errorf("Expected garbage to be skipped and K0 released, got %v (%v)", m, err)
+	}
+	if _, err = c.ReadMessage(); err == nil {
+		t.Error("Expected EOF")
+	}
+	c.WriteMessage(&Message{Type: LED, Key: "K0", Value: 1})
+	c.WriteMessage(&Message{Type: Progress, Key: "K0", Value: 1})
+	if s.out.String() != "K01\nP0-1\n" {
+		t.Errorf("Unexpected output %q", s.out.String())
+	}
+}
@@ -0,0 +1,201 @@
+// Package protocol implements the wire protocol spoken between the server and
+// the pad. Two codecs are available, both exchanging newline terminated lines.
+//
+// Legacy (version 0) is the original line format:
+//
+//	K<n><0|1>      pad -> server  key <n> pressed (0) or released (1)
+//	E<n><0|1>      pad -> server  push of encoder <n> pressed (0) or released (1)
+//	E<n><+|-><s>   pad -> server  encoder <n> turned <s> steps clockwise (+)
+//	               or counter-clockwise (-), <s> defaults to 1
+//	A<n>=<value>   pad -> server  analog input <n> moved to value (0 to 1023)
+//	K<n><0|1>      server -> pad  LED of key <n> off (0) or on (1)
+//	P<n>-<value>   server -> pad  progress of key <n>, 0 (off) to 255
+//
+// Framed (version 1) wraps every message in a checksummed frame:
+//
+//	~<version>|<seq>|<type>[|<field>...]*<checksum>
+//
+// where checksum is the XOR of every byte between '~' and '*' written as two
+// uppercase hexadecimal digits. seq is a decimal sequence number incremented by
+// the sender for each frame. The message types and their fields are:
+//
+//	HELLO|<attr>=<value>...   both ways, opens the session (see Negotiate and
+//	                          Capabilities for the attributes sent by the pad)
+//	KEY|<key>|<0|1>           pad -> server, key released (0) or pressed (1),
+//	                          encoder pushes are keys named E<n>
+//	ENC|<encoder>|<steps>     pad -> server, encoder E<n> turned, clockwise
+//	                          when steps is positive
+//	ANLG|<input>|<value>      pad -> server, analog input A<n> moved, value
+//	                          from 0 to 1023
+//	LED|<key>|<0|1>           server -> pad, LED off (0) or on (1)
+//	PROG|<key>|<value>        server -> pad, progress from 0 (off) to 255
+//	ACK                       seq is the acknowledged frame
+//	NACK                      seq is the rejected frame
+//
+// Every frame but ACK and NACK is acknowledged by the receiver. A frame with an
+// invalid checksum is answered with NACK and the sender transmits it again.
+// Frames received twice in a row with the same seq are acknowledged but only
+// delivered once.
+//
+// The server opens the session by sending HELLO with version=1. A pad speaking
+// the framed protocol answers with its own HELLO, any other answer or silence
+// makes the server fall back to the legacy codec.
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Type of a message
+type Type string
+
+const (
+	// Hello opens a framed session
+	Hello Type = "HELLO"
+	// Key reports a key press or release
+	Key Type = "KEY"
+	// LED sets the LED of a key
+	LED Type = "LED"
+	// Progress sets the progress of a key
+	Progress Type = "PROG"
+	// Encoder reports the steps of a rotary encoder
+	Encoder Type = "ENC"
+	// Analog reports the value of an analog input such as a slider
+	Analog Type = "ANLG"
+	// Ack acknowledges a frame
+	Ack Type = "ACK"
+	// Nack rejects a frame
+	Nack Type = "NACK"
+)
+
+// Message exchanged with the pad
+type Message struct {
+	Type Type
+	// Seq is the frame sequence number, unused by the legacy codec
+	Seq uint16
+	// Key name, e.g. K0
+	Key string
+	// Value is 1 for pressed keys and lit LEDs, the progress for Progress,
+	// the signed steps for Encoder and the value for Analog
+	Value int
+	// Attrs of a Hello message
+	Attrs map[string]string
+}
+
+// Pressed returns true if the message is a key press
+func (m *Message) Pressed() bool {
+	return m.Type == Key && m.Value == 1
+}
+
+func (m *Message) String() string {
+	switch m.Type {
+	case Key, LED, Progress, Encoder, Analog:
+		return fmt.Sprintf("%s %s %d", m.Type, m.Key, m.Value)
+	case Hello:
+		return fmt.Sprintf("%s %s", m.Type, strings.Join(attrs(m.Attrs), " "))
+	}
+	return fmt.Sprintf("%s %d", m.Type, m.Seq)
+}
+
+func attrs(m map[string]string) []string {
+	var a []string
+	for k, v := range m {
+		a = append(a, k+"="+v)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// Codec reads and writes messages on a link to the pad
+type Codec interface {
+	// ReadMessage blocks until a message is received from the pad
+	ReadMessage() (*Message, error)
+	// WriteMessage sends a message to the pad
+	WriteMessage(*Message) error
+	// Version of the protocol, 0 being the legacy line format
+	Version() int
+}
+
+// ErrTimeout is returned by reads which did not complete in time
+var ErrTimeout = errors.New("timeout")
+
+// lineReader reads lines from the pad, optionally with a timeout. A read which
+// timed out is carried over to the next call so that no line is lost.
+type lineReader struct {
+	in      *bufio.Reader
+	pending chan lineResult
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{in: bufio.NewReader(r)}
+}
+
+func (r *lineReader) next(timeout time.Duration) (string, error) {
+	if r.pending == nil {
+		r.pending = make(chan lineResult, 1)
+		go func(c chan<- lineResult) {
+			line, _, err := r.in.ReadLine()
+			c <- lineResult{line: strings.TrimRight(string(line), "\r\n"), err: err}
+		}(r.pending)
+	}
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	select {
+	case res := <-r.pending:
+		r.pending = nil
+		return res.line, res.err
+	case <-timer:
+		return "", ErrTimeout
+	}
+}
+
+// Negotiate opens a session on rw, returning the framed codec if the pad
+// answers the handshake within timeout and the legacy codec otherwise.
+func Negotiate(rw io.ReadWriter, timeout time.Duration) (Codec, error) {
+	lr := newLineReader(rw)
+	f := newFramed(lr, rw)
+	if err := f.WriteMessage(&Message{Type: Hello, Attrs: map[string]string{"version": "1"}}); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return newLegacy(lr, rw), nil
+		}
+		line, err := lr.next(remaining)
+		if err == ErrTimeout {
+			return newLegacy(lr, rw), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "~") {
+			// Legacy pad, keep the line for the legacy codec
+			l := newLegacy(lr, rw)
+			l.unread = append(l.unread, line)
+			return l, nil
+		}
+		m, err := f.receive(line)
+		if err != nil || m == nil {
+			continue
+		}
+		if m.Type == Hello {
+			f.hello = m
+			return f, nil
+		}
+	}
+}
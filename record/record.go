@@ -0,0 +1,146 @@
+// Package record writes the traffic between the orchestrator and the pads to
+// a file and replays such recordings. A recording has one line per protocol
+// line, with the time elapsed since the start of the recording, the device,
+// the direction (< from the pad, > to the pad) and the line itself:
+//
+//	0.000000 default < K00
+//	0.001250 default > K01
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry of a recording
+type Entry struct {
+	// At is the time elapsed since the start of the recording
+	At      time.Duration
+	Device  string
+	Inbound bool
+	Line    string
+}
+
+func (e Entry) String() string {
+	dir := ">"
+	if e.Inbound {
+		dir = "<"
+	}
+	return fmt.Sprintf("%.6f %s %s %s", e.At.Seconds(), e.Device, dir, e.Line)
+}
+
+// ParseEntry reads an entry from a line of a recording
+func ParseEntry(line string) (Entry, error) {
+	var e Entry
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 || (fields[2] != "<" && fields[2] != ">") {
+		return e, fmt.Errorf("malformed entry %q", line)
+	}
+	s, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return e, fmt.Errorf("malformed time in entry %q", line)
+	}
+	e.At = time.Duration(s * float64(time.Second))
+	e.Device = fields[1]
+	e.Inbound = fields[2] == "<"
+	e.Line = fields[3]
+	return e, nil
+}
+
+// Parse a whole recording
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := ParseEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Recorder writes entries, timestamped with the monotonic clock
+type Recorder struct {
+	mu    sync.Mutex
+	out   io.Writer
+	start time.Time
+}
+
+// NewRecorder returns a recorder writing to out
+func NewRecorder(out io.Writer) *Recorder {
+	return &Recorder{out: out, start: time.Now()}
+}
+
+// Record a line
+func (r *Recorder) Record(device string, inbound bool, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := Entry{At: time.Since(r.start), Device: device, Inbound: inbound, Line: line}
+	fmt.Fprintln(r.out, e)
+}
+
+// Stop recording, lines are discarded from now on
+func (r *Recorder) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.out = ioutil.Discard
+}
+
+// Wrap returns rw recording every complete line read from or written to it
+func (r *Recorder) Wrap(device string, rw io.ReadWriteCloser) io.ReadWriteCloser {
+	return &recorded{rw: rw, device: device, recorder: r}
+}
+
+type recorded struct {
+	rw       io.ReadWriteCloser
+	device   string
+	recorder *Recorder
+	in       bytes.Buffer
+	mu       sync.Mutex
+	out      bytes.Buffer
+}
+
+// lines records the complete lines of buf, keeping the last partial one
+func (c *recorded) lines(buf *bytes.Buffer, inbound bool) {
+	for {
+		i := bytes.IndexByte(buf.Bytes(), '\n')
+		if i < 0 {
+			return
+		}
+		line := string(buf.Next(i + 1))
+		c.recorder.Record(c.device, inbound, strings.TrimRight(line, "\r\n"))
+	}
+}
+
+func (c *recorded) Read(p []byte) (int, error) {
+	n, err := c.rw.Read(p)
+	c.in.Write(p[:n])
+	c.lines(&c.in, true)
+	return n, err
+}
+
+func (c *recorded) Write(p []byte) (int, error) {
+	n, err := c.rw.Write(p)
+	c.mu.Lock()
+	c.out.Write(p[:n])
+	c.lines(&c.out, false)
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *recorded) Close() error {
+	return c.rw.Close()
+}
@@ -0,0 +1,167 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hlidotbe/macropad/pad"
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+type nopCloser struct {
+	io.ReadWriter
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestEntry(t *testing.T) {
+	e := Entry{At: 1500 * time.Millisecond, Device: "left", Inbound: true, Line: "K0 0"}
+	p, err := ParseEntry(e.String())
+	if err != nil || p != e {
+		t.Errorf("Expected %v, got %v (%v)", e, p, err)
+	}
+	if _, err = ParseEntry("1.0 left ? K00"); err == nil {
+		t.Error("Expected an invalid direction to be rejected")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	out := new(bytes.Buffer)
+	port := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader("K00\nK01\n"), ioutil.Discard}
+	rw := NewRecorder(out).Wrap("default", nopCloser{port})
+	ioutil.ReadAll(rw)
+	rw.Write([]byte("K0"))
+	rw.Write([]byte("1\n"))
+
+	entries, err := Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"< K00", "< K01", "> K01"}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), entries)
+	}
+	for i, e := range entries {
+		if !strings.HasSuffix(e.String(), expected[i]) {
+			t.Errorf("Expected entry %d to end with %s, got %v", i, expected[i], e)
+		}
+	}
+}
+
+type ledAction struct {
+	name string
+	out  chan<- pad.ActionMessage
+}
+
+func (a *ledAction) Execute() error {
+	a.out <- pad.ActionMessage{ActionName: a.name, State: 1}
+	return nil
+}
+
+func (a *ledAction) Stop() {
+}
+
+func TestReplay(t *testing.T) {
+	recording := "# pressing K1\n0.000000 default < K10\n0.010000 default > K11\n0.020000 default < K11\n"
+	entries, err := Parse(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orch := pad.NewOchestrator(nil)
+	orch.RegisterAction("K1", &ledAction{name: "K1", out: orch.Com})
+	go orch.Run()
+	defer orch.Shutdown()
+
+	out := new(bytes.Buffer)
+	if err = Replay(entries, orch, 10, out); err != nil {
+		t.Fatal(err)
+	}
+	replayed, _ := Parse(out)
+	var lines []string
+	for _, e := range replayed {
+		lines = append(lines, e.String()[strings.Index(e.String(), " ")+1:])
+	}
+	if strings.Join(lines, "\n") != "default < K10\ndefault > K11\ndefault < K11" {
+		t.Errorf("Unexpected replay %v", lines)
+	}
+}
+
+// framedRecording returns the recording of a framed pad pressing K1
+func framedRecording() string {
+	lines := []*protocol.Message{
+		{Type: protocol.Hello, Attrs: map[string]string{"version": "1", "keys": "4"}},
+		{Type: protocol.Key, Seq: 1, Key: "K1", Value: 1},
+		{Type: protocol.Key, Seq: 2, Key: "K1", Value: 0},
+	}
+	var recording string
+	for i, m := range lines {
+		recording += fmt.Sprintf("0.0%d0000 default < %s\n", i, protocol.FormatFrame(m))
+	}
+	return recording
+}
+
+func TestReplay_Framed(t *testing.T) {
+	entries, err := Parse(strings.NewReader(framedRecording()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orch := pad.NewOchestrator(nil)
+	orch.RegisterAction("K1", &ledAction{name: "K1", out: orch.Com})
+	go orch.Run()
+	defer orch.Shutdown()
+
+	out := new(bytes.Buffer)
+	if err = Replay(entries, orch, 10, out); err != nil {
+		t.Fatal(err)
+	}
+	replayed, _ := Parse(out)
+	var led bool
+	for _, e := range replayed {
+		if m, err := protocol.ParseFrame(e.Line); !e.Inbound && err == nil && m.Type == protocol.LED && m.Key == "K1" {
+			led = true
+		}
+	}
+	if !led {
+		t.Errorf("Expected the LED of K1 to be lit through the framed protocol, got %v", replayed)
+	}
+}
+
+func TestReplay_NegotiationFailure(t *testing.T) {
+	old := negotiate
+	defer func() { negotiate = old }()
+	negotiate = func(rw io.ReadWriter, timeout time.Duration) (protocol.Codec, error) {
+		return nil, errors.New("no hello")
+	}
+
+	entries, err := Parse(strings.NewReader(framedRecording()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orch := pad.NewOchestrator(nil)
+	go orch.Run()
+	defer orch.Shutdown()
+
+	done := make(chan error)
+	go func() {
+		done <- Replay(entries, orch, 0, new(bytes.Buffer))
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "no hello") {
+			t.Errorf("Expected the negotiation to fail the replay, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the replay to fail, it hung")
+	}
+}
@@ -0,0 +1,104 @@
+package record
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/hlidotbe/macropad/pad"
+	"github.com/hlidotbe/macropad/protocol"
+)
+
+// settle is the time left to the orchestrator to answer the last line
+const settle = 100 * time.Millisecond
+
+// negotiate the protocol of the framed devices, replaced in tests
+var negotiate = protocol.Negotiate
+
+// replayPort feeds the recorded lines of a device to the orchestrator
+type replayPort struct {
+	in  *io.PipeReader
+	pad *io.PipeWriter
+}
+
+func (p *replayPort) Read(b []byte) (int, error) {
+	return p.in.Read(b)
+}
+
+func (p *replayPort) Write(b []byte) (int, error) {
+	return ioutil.Discard.Write(b)
+}
+
+func (p *replayPort) Close() error {
+	return p.in.Close()
+}
+
+// Replay feeds the inbound lines of entries to o, speed times faster than they
+// were recorded (as fast as possible when speed is 0). The traffic of the
+// replay is recorded to out so that it can be compared to the original one.
+// Devices whose first line is a frame go through the handshake, the other
+// ones speak the legacy protocol, failing the replay when it does not succeed.
+func Replay(entries []Entry, o *pad.Orchestrator, speed float64, out io.Writer) error {
+	recorder := NewRecorder(out)
+	ports := make(map[string]*replayPort)
+	failed := make(chan error, 1)
+	defer func() {
+		recorder.Stop()
+		for device, p := range ports {
+			o.DetachDevice(device)
+			p.pad.Close()
+		}
+	}()
+	var previous time.Duration
+	for _, e := range entries {
+		if !e.Inbound {
+			continue
+		}
+		if speed > 0 && e.At > previous {
+			time.Sleep(time.Duration(float64(e.At-previous) / speed))
+		}
+		previous = e.At
+		p, ok := ports[e.Device]
+		if !ok {
+			p = new(replayPort)
+			p.in, p.pad = io.Pipe()
+			ports[e.Device] = p
+			go func(device string, port io.ReadWriter, framed bool) {
+				if err := attach(o, device, port, framed); err != nil {
+					err = fmt.Errorf("%s: %v", device, err)
+					// nobody reads the lines of the device, stop writing them
+					p.in.CloseWithError(err)
+					select {
+					case failed <- err:
+					default:
+					}
+				}
+			}(e.Device, recorder.Wrap(e.Device, p), strings.HasPrefix(e.Line, "~"))
+		}
+		if _, err := io.WriteString(p.pad, e.Line+"\n"); err != nil {
+			return err
+		}
+	}
+	time.Sleep(settle)
+	select {
+	case err := <-failed:
+		return err
+	default:
+		return nil
+	}
+}
+
+func attach(o *pad.Orchestrator, device string, port io.ReadWriter, framed bool) error {
+	if !framed {
+		o.AttachDevice(device, protocol.NewLegacyCodec(port))
+		return nil
+	}
+	codec, err := negotiate(port, time.Second)
+	if err != nil {
+		return err
+	}
+	o.AttachDevice(device, codec)
+	return nil
+}
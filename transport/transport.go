@@ -0,0 +1,255 @@
+// Package transport links the orchestrator to pads over the network.
+//
+// Every connection starts with the connecting side sending
+//
+//	AUTH <token>
+//
+// to which the accepting side answers OK before the pad protocol starts, or
+// closes the connection if the token is wrong. While another pad is attached,
+// the accepting side answers BUSY and closes the connection.
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authTimeout bounds the time a new connection has to authenticate
+const authTimeout = 5 * time.Second
+
+// busyTimeout is how long an authenticated pad waits for Accept when no pad
+// is attached, replaced in tests
+var busyTimeout = 5 * time.Second
+
+// ErrNoToken is returned when a network transport is set up without a token
+var ErrNoToken = errors.New("network transports require a token")
+
+// ErrClosed is returned by Accept once the transport is closed
+var ErrClosed = errors.New("transport closed")
+
+// Config selects how the pad is reached
+type Config struct {
+	// Type is serial (the default), tcp-server, tcp-client or websocket
+	Type string `json:"type,omitempty"`
+	// Address to listen on for tcp-server, to connect to for tcp-client and
+	// the HTTP path for websocket
+	Address string `json:"address,omitempty"`
+	// Token authenticating each connection
+	Token string `json:"token,omitempty"`
+	// Origins of the web pages allowed to open a websocket besides the ones
+	// served by the daemon, e.g. https://pad.example.com
+	Origins []string `json:"origins,omitempty"`
+}
+
+// conn is a net.Conn whose reads go through the reader used while authenticating
+type conn struct {
+	net.Conn
+	in *bufio.Reader
+	// release tells the server the pad is gone, nil for dialed connections
+	release func()
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+func (c *conn) Close() error {
+	if c.release != nil {
+		c.release()
+	}
+	return c.Conn.Close()
+}
+
+// attachment tells whether the pad handed over by Accept is still connected,
+// the other pads are turned away meanwhile
+type attachment struct {
+	mu       sync.Mutex
+	attached bool
+}
+
+func (a *attachment) busy() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.attached
+}
+
+// attach a pad, returning the func to call once it is gone
+func (a *attachment) attach() func() {
+	a.mu.Lock()
+	a.attached = true
+	a.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			a.attached = false
+			a.mu.Unlock()
+		})
+	}
+}
+
+func validToken(expected, line string) bool {
+	if !strings.HasPrefix(line, "AUTH ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.TrimPrefix(line, "AUTH "))) == 1
+}
+
+func readLine(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Server accepts pads connecting over TCP, authenticating each connection
+// on its own
+type Server struct {
+	listener net.Listener
+	token    string
+	pads     attachment
+	// conns are the authenticated connections waiting for Accept
+	conns chan *conn
+	// done is closed with err once the listener fails
+	done chan bool
+	err  error
+}
+
+// Listen on address for pads authenticating with token
+func Listen(address string, token string) (*Server, error) {
+	if len(token) == 0 {
+		return nil, ErrNoToken
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: l, token: token, conns: make(chan *conn), done: make(chan bool)}
+	go s.serve()
+	return s, nil
+}
+
+// serve authenticates the connections until the listener fails
+func (s *Server) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			s.err = err
+			close(s.done)
+			return
+		}
+		go s.authenticate(c)
+	}
+}
+
+// authenticate a connection and hand it to Accept, answering BUSY while a
+// pad is attached or when Accept does not take it in time
+func (s *Server) authenticate(c net.Conn) {
+	in := bufio.NewReader(c)
+	c.SetDeadline(time.Now().Add(authTimeout))
+	line, err := readLine(in)
+	if err != nil || !validToken(s.token, line) {
+		log.Printf("Rejected connection from %v\n", c.RemoteAddr())
+		c.Close()
+		return
+	}
+	if s.pads.busy() {
+		refuse(c)
+		return
+	}
+	select {
+	case s.conns <- &conn{Conn: c, in: in}:
+	case <-time.After(busyTimeout):
+		refuse(c)
+	case <-s.done:
+		c.Close()
+	}
+}
+
+// refuse a pad while another one is attached
+func refuse(c net.Conn) {
+	log.Printf("Rejected connection from %v, a pad is attached\n", c.RemoteAddr())
+	c.Write([]byte("BUSY\n"))
+	c.Close()
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Accept blocks until a pad connects and authenticates or ctx is done, it can
+// be used as a pad.Opener
+func (s *Server) Accept(ctx context.Context) (io.ReadWriteCloser, error) {
+	for {
+		select {
+		case c := <-s.conns:
+			c.release = s.pads.attach()
+			c.SetDeadline(time.Now().Add(authTimeout))
+			if _, err := c.Write([]byte("OK\n")); err != nil {
+				c.Close()
+				continue
+			}
+			c.SetDeadline(time.Time{})
+			return c, nil
+		case <-s.done:
+			return nil, s.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close the server
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Dial connects to a pad served on address, e.g. by a bridge
+func Dial(address string, token string) (io.ReadWriteCloser, error) {
+	if len(token) == 0 {
+		return nil, ErrNoToken
+	}
+	c, err := net.DialTimeout("tcp", address, authTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c.SetDeadline(time.Now().Add(authTimeout))
+	if _, err = fmt.Fprintf(c, "AUTH %s\n", token); err != nil {
+		c.Close()
+		return nil, err
+	}
+	in := bufio.NewReader(c)
+	line, err := readLine(in)
+	if line == "BUSY" {
+		c.Close()
+		return nil, fmt.Errorf("%s is busy with another pad", address)
+	}
+	if err != nil || line != "OK" {
+		c.Close()
+		return nil, fmt.Errorf("%s refused the token", address)
+	}
+	c.SetDeadline(time.Time{})
+	return &conn{Conn: c, in: in}, nil
+}
+
+// Pipe copies data both ways between a and b until either side fails
+func Pipe(a io.ReadWriter, b io.ReadWriter) error {
+	errs := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(a, b)
+		errs <- err
+	}()
+	go func() {
+		_, err := io.Copy(b, a)
+		errs <- err
+	}()
+	return <-errs
+}
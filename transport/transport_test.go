@@ -0,0 +1,228 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestServer(t *testing.T) {
+	s, err := Listen("127.0.0.1:0", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	go func() {
+		// Wrong token first, then the right one
+		bad, _ := net.Dial("tcp", s.Addr().String())
+		fmt.Fprintf(bad, "AUTH guess\n")
+		good, err := Dial(s.Addr().String(), "secret")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		good.Write([]byte("K00\n"))
+	}()
+
+	c, err := s.Accept(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || line != "K00\n" {
+		t.Errorf("Expected 'K00', got '%s' (%v)", line, err)
+	}
+}
+
+func TestServer_Concurrent(t *testing.T) {
+	s, err := Listen("127.0.0.1:0", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// A silent connection does not hold back the next one
+	silent, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go Dial(s.Addr().String(), "secret")
+	accepted := make(chan bool)
+	go func() {
+		if c, err := s.Accept(context.Background()); err == nil {
+			c.Close()
+		}
+		close(accepted)
+	}()
+	select {
+	case <-accepted:
+	case <-time.After(authTimeout / 2):
+		t.Error("Expected the pad to be accepted before the silent connection times out")
+	}
+}
+
+func TestServer_Busy(t *testing.T) {
+	s, err := Listen("127.0.0.1:0", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	accepted := make(chan io.ReadWriteCloser, 1)
+	go func() {
+		c, _ := s.Accept(context.Background())
+		accepted <- c
+	}()
+	first, err := Dial(s.Addr().String(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	started := time.Now()
+	if _, err = Dial(s.Addr().String(), "secret"); err == nil || !strings.Contains(err.Error(), "busy") {
+		t.Errorf("Expected the second pad to be told the server is busy, got %v", err)
+	}
+	if time.Since(started) > busyTimeout/2 {
+		t.Error("Expected the second pad to be told right away")
+	}
+
+	// Once the first pad is gone, the next one is accepted
+	(<-accepted).Close()
+	go s.Accept(context.Background())
+	if _, err = Dial(s.Addr().String(), "secret"); err != nil {
+		t.Errorf("Expected the pad to be accepted, got %v", err)
+	}
+}
+
+func TestDial_Refused(t *testing.T) {
+	s, err := Listen("127.0.0.1:0", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.Accept(context.Background())
+	if _, err = Dial(s.Addr().String(), "guess"); err == nil {
+		t.Error("Expected the token to be refused")
+	}
+	if _, err = Listen("127.0.0.1:0", ""); err != ErrNoToken {
+		t.Errorf("Expected a token to be required, got %v", err)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	w, err := NewWebSocket("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(w)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteMessage(websocket.TextMessage, []byte("AUTH secret"))
+
+	c, _ := w.Accept(context.Background())
+	if _, msg, err := ws.ReadMessage(); err != nil || string(msg) != "OK" {
+		t.Fatalf("Expected OK, got '%s' (%v)", msg, err)
+	}
+	ws.WriteMessage(websocket.TextMessage, []byte("K10"))
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || line != "K10\n" {
+		t.Errorf("Expected 'K10', got '%s' (%v)", line, err)
+	}
+	c.Write([]byte("K11\nP1-3\n"))
+	for _, expected := range []string{"K11", "P1-3"} {
+		if _, msg, err := ws.ReadMessage(); err != nil || string(msg) != expected {
+			t.Errorf("Expected '%s', got '%s' (%v)", expected, msg, err)
+		}
+	}
+}
+
+func TestWebSocket_Busy(t *testing.T) {
+	w, err := NewWebSocket("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(w)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	first.WriteMessage(websocket.TextMessage, []byte("AUTH secret"))
+	c, err := w.Accept(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.WriteMessage(websocket.TextMessage, []byte("AUTH secret"))
+	second.SetReadDeadline(time.Now().Add(busyTimeout / 2))
+	_, _, err = second.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected the pad to be told to try again later, got %v", err)
+	}
+}
+
+func TestWebSocket_Close(t *testing.T) {
+	w, err := NewWebSocket("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go w.Close()
+	if _, err = w.Accept(context.Background()); err != ErrClosed {
+		t.Errorf("Expected Accept to return once closed, got %v", err)
+	}
+}
+
+func TestWebSocket_Origin(t *testing.T) {
+	w, err := NewWebSocket("secret", "https://pad.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(w)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for origin, allowed := range map[string]bool{
+		"":                         true,
+		server.URL:                 true,
+		"https://pad.example.com":  true,
+		"https://evil.example.com": false,
+	} {
+		header := http.Header{}
+		if len(origin) > 0 {
+			header.Set("Origin", origin)
+		}
+		ws, _, err := websocket.DefaultDialer.Dial(url, header)
+		if (err == nil) != allowed {
+			t.Errorf("Expected %q to be allowed: %v, got %v", origin, allowed, err)
+		}
+		if ws != nil {
+			ws.Close()
+		}
+	}
+}
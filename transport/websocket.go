@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket accepts pads connecting to the web server, e.g. a software pad
+// running in a phone browser. Each text message carries one protocol line.
+type WebSocket struct {
+	token    string
+	origins  map[string]bool
+	upgrader websocket.Upgrader
+	pads     attachment
+	conns    chan *wsConn
+	closed   chan bool
+	close    sync.Once
+}
+
+// NewWebSocket returns a handler for pads authenticating with token. Browsers
+// may open the socket from the pages of the daemon or of origins, other
+// clients send no origin.
+func NewWebSocket(token string, origins ...string) (*WebSocket, error) {
+	if len(token) == 0 {
+		return nil, ErrNoToken
+	}
+	w := &WebSocket{token: token, origins: make(map[string]bool), conns: make(chan *wsConn), closed: make(chan bool)}
+	for _, o := range origins {
+		w.origins[strings.TrimRight(o, "/")] = true
+	}
+	w.upgrader.CheckOrigin = w.checkOrigin
+	return w, nil
+}
+
+// checkOrigin allows clients without origin, the pages served by the daemon
+// and the configured origins
+func (w *WebSocket) checkOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if len(origin) == 0 || w.origins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, request.Host)
+}
+
+func (w *WebSocket) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	ws, err := w.upgrader.Upgrade(response, request, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	ws.SetReadDeadline(time.Now().Add(authTimeout))
+	_, msg, err := ws.ReadMessage()
+	if err != nil || !validToken(w.token, strings.TrimRight(string(msg), "\r\n")) {
+		log.Printf("Rejected connection from %v\n", request.RemoteAddr)
+		ws.Close()
+		return
+	}
+	ws.SetReadDeadline(time.Time{})
+	if w.pads.busy() {
+		refuseWebSocket(ws, request)
+		return
+	}
+	select {
+	case w.conns <- &wsConn{ws: ws}:
+	case <-request.Context().Done():
+		ws.Close()
+	case <-w.closed:
+		ws.Close()
+	case <-time.After(busyTimeout):
+		refuseWebSocket(ws, request)
+	}
+}
+
+// refuseWebSocket closes the socket of a pad while another one is attached,
+// asking it to try again later
+func refuseWebSocket(ws *websocket.Conn, request *http.Request) {
+	log.Printf("Rejected connection from %v, a pad is attached\n", request.RemoteAddr)
+	busy := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "BUSY")
+	ws.WriteControl(websocket.CloseMessage, busy, time.Now().Add(authTimeout))
+	ws.Close()
+}
+
+// Accept blocks until a pad connects and authenticates, ctx is done or the
+// handler is closed. It can be used as a pad.Opener.
+func (w *WebSocket) Accept(ctx context.Context) (io.ReadWriteCloser, error) {
+	for {
+		var c *wsConn
+		select {
+		case c = <-w.conns:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.closed:
+			return nil, ErrClosed
+		}
+		c.release = w.pads.attach()
+		if err := c.ws.WriteMessage(websocket.TextMessage, []byte("OK")); err != nil {
+			c.Close()
+			continue
+		}
+		return c, nil
+	}
+}
+
+// Close the handler, Accept returns ErrClosed and new pads are turned away
+func (w *WebSocket) Close() error {
+	w.close.Do(func() {
+		close(w.closed)
+	})
+	return nil
+}
+
+type wsConn struct {
+	ws  *websocket.Conn
+	buf bytes.Buffer
+	mu  sync.Mutex
+	// release tells the handler the pad is gone
+	release func()
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		_, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.buf.Write(msg)
+		if !bytes.HasSuffix(msg, []byte("\n")) {
+			c.buf.WriteByte('\n')
+		}
+	}
+	return c.buf.Read(p)
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		line = strings.TrimRight(line, "\n")
+		if len(line) == 0 {
+			continue
+		}
+		if err := c.ws.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	if c.release != nil {
+		c.release()
+	}
+	return c.ws.Close()
+}
@@ -0,0 +1,122 @@
+// Package virtual provides a pad living on a pseudo-terminal, for development
+// without hardware and for tests. The orchestrator is attached to the host end
+// while scripts, terminals or tests drive the pad end found at Path.
+package virtual
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// Pad is a virtual pad speaking the legacy line format
+type Pad struct {
+	host  *os.File
+	pad   *os.File
+	lines chan string
+}
+
+// New creates the pseudo-terminal pair backing a virtual pad
+func New() (*Pad, error) {
+	host, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+	// No echo nor newline translation, the pad end carries raw protocol lines
+	if _, err = term.MakeRaw(int(tty.Fd())); err != nil {
+		host.Close()
+		tty.Close()
+		return nil, err
+	}
+	p := &Pad{host: host, pad: tty, lines: make(chan string, 100)}
+	return p, nil
+}
+
+// Path of the pad end, which can be opened by other processes
+func (p *Pad) Path() string {
+	return p.pad.Name()
+}
+
+// Host returns the end the orchestrator should be attached to
+func (p *Pad) Host() io.ReadWriteCloser {
+	return p.host
+}
+
+// Listen starts collecting the lines sent by the orchestrator, they are then
+// returned by ReadLine. It must not be used while another process reads Path.
+func (p *Pad) Listen() {
+	go func() {
+		in := bufio.NewReader(p.pad)
+		for {
+			line, err := in.ReadString('\n')
+			if err != nil {
+				close(p.lines)
+				return
+			}
+			p.lines <- strings.TrimRight(line, "\r\n")
+		}
+	}()
+}
+
+// Send a raw protocol line to the orchestrator
+func (p *Pad) Send(line string) error {
+	_, err := fmt.Fprintf(p.pad, "%s\n", line)
+	return err
+}
+
+// Press key, e.g. K0
+func (p *Pad) Press(key string) error {
+	return p.Send(key + "0")
+}
+
+// Release key
+func (p *Pad) Release(key string) error {
+	return p.Send(key + "1")
+}
+
+// Tap presses and releases key
+func (p *Pad) Tap(key string) error {
+	if err := p.Press(key); err != nil {
+		return err
+	}
+	return p.Release(key)
+}
+
+// ReadLine returns the next line sent by the orchestrator, see Listen
+func (p *Pad) ReadLine(timeout time.Duration) (string, error) {
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", io.EOF
+		}
+		return line, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("no line received in %v", timeout)
+	}
+}
+
+// Expect reads lines until line is received or timeout expires
+func (p *Pad) Expect(line string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		got, err := p.ReadLine(deadline.Sub(time.Now()))
+		if err != nil {
+			return fmt.Errorf("expected %q: %v", line, err)
+		}
+		if got == line {
+			return nil
+		}
+	}
+}
+
+// Close both ends
+func (p *Pad) Close() error {
+	p.host.Close()
+	return p.pad.Close()
+}
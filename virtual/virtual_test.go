@@ -0,0 +1,42 @@
+package virtual
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hlidotbe/macropad/pad"
+)
+
+type ledAction struct {
+	name string
+	out  chan<- pad.ActionMessage
+}
+
+func (a *ledAction) Execute() error {
+	a.out <- pad.ActionMessage{ActionName: a.name, State: 1}
+	return nil
+}
+
+func (a *ledAction) Stop() {
+}
+
+func TestVirtualPad(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Skipf("No pseudo-terminal available: %v", err)
+	}
+	defer p.Close()
+	p.Listen()
+
+	orch := pad.NewOchestrator(p.Host())
+	orch.RegisterAction("K2", &ledAction{name: "K2", out: orch.Com})
+	go orch.Run()
+	defer orch.Shutdown()
+
+	if err = p.Tap("K2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Expect("K21", time.Second); err != nil {
+		t.Error(err)
+	}
+}